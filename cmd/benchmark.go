@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/cobra"
+)
+
+const (
+	benchmarkPrefix  = "dbcopy-benchmark/"
+	benchmarkTimeout = time.Hour
+	cleanupTimeout   = time.Minute
+)
+
+var (
+	benchmarkCmd = cobra.Command{
+		Use:   "benchmark -b my-bucket [--size size] [-n count | --duration d]",
+		Short: "Measure upload and download throughput to the bucket",
+		Long: `Measure upload and download throughput to the bucket.
+
+It uploads synthetic object of --size and downloads it back, --count times or
+during --duration, and deletes it after that.`,
+		Args:                  cobra.NoArgs,
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			size, err := parseBytes(benchmarkSize)
+			if err != nil {
+				return fmt.Errorf("parse --size: %w", err)
+			} else if size <= 0 {
+				return fmt.Errorf("unexpected --size=%q", benchmarkSize)
+			} else if err := rootSetup(); err != nil {
+				return err
+			}
+
+			ctx, cancel := commandContext(benchmarkTimeout)
+			defer cancel()
+			return NewBenchmark(s3Client, s3Bucket, size).
+				WithCount(benchmarkCount).
+				WithDuration(benchmarkDuration).
+				Run(ctx)
+		},
+	}
+
+	benchmarkSize     string
+	benchmarkCount    int
+	benchmarkDuration time.Duration
+)
+
+func init() {
+	benchmarkCmd.Flags().StringVar(&benchmarkSize, "size", "16MiB",
+		"size of synthetic object")
+	benchmarkCmd.Flags().IntVarP(&benchmarkCount, "count", "n", 3,
+		"upload and download this many times")
+	benchmarkCmd.Flags().DurationVar(&benchmarkDuration, "duration", 0,
+		"upload and download until this time passed, instead of --count")
+}
+
+func NewBenchmark(client *s3.Client, bucket string, size int64) *Benchmark {
+	return &Benchmark{client: client, bucket: bucket, size: size, count: 1}
+}
+
+type Benchmark struct {
+	client   *s3.Client
+	bucket   string
+	size     int64
+	count    int
+	duration time.Duration
+}
+
+func (self *Benchmark) WithCount(n int) *Benchmark {
+	self.count = max(n, 1)
+	return self
+}
+
+// WithDuration configures Benchmark to run until d passed, instead of
+// configured count of rounds.
+func (self *Benchmark) WithDuration(d time.Duration) *Benchmark {
+	self.duration = d
+	return self
+}
+
+func (self *Benchmark) Run(ctx context.Context) error {
+	body := make([]byte, self.size)
+	if _, err := rand.Read(body); err != nil {
+		return fmt.Errorf("generate object: %w", err)
+	}
+
+	key, err := benchmarkKey()
+	if err != nil {
+		return err
+	}
+	defer self.cleanup(key)
+
+	var uploads, downloads []time.Duration
+	startedAt := time.Now()
+	for i := 0; self.more(i, startedAt); i++ {
+		d, err := self.upload(ctx, key, body)
+		if err != nil {
+			return err
+		}
+		uploads = append(uploads, d)
+
+		if d, err = self.download(ctx, key); err != nil {
+			return err
+		}
+		downloads = append(downloads, d)
+	}
+
+	self.report("upload", uploads)
+	self.report("download", downloads)
+	return nil
+}
+
+func benchmarkKey() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate key: %w", err)
+	}
+	return objectName(benchmarkPrefix + hex.EncodeToString(b)), nil
+}
+
+func (self *Benchmark) more(i int, startedAt time.Time) bool {
+	if self.duration > 0 {
+		return i == 0 || time.Since(startedAt) < self.duration
+	}
+	return i < self.count
+}
+
+func (self *Benchmark) upload(ctx context.Context, key string, body []byte,
+) (time.Duration, error) {
+	t := time.Now()
+	_, err := self.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(self.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(body),
+		ContentLength: aws.Int64(int64(len(body))),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("upload %q: %w", key, err)
+	}
+	return time.Since(t), nil
+}
+
+func (self *Benchmark) download(ctx context.Context, key string,
+) (time.Duration, error) {
+	t := time.Now()
+	resp, err := self.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(self.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("read %q: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return 0, fmt.Errorf("read %q: %w", key, err)
+	}
+	return time.Since(t), nil
+}
+
+// cleanup deletes key, even if ctx of the benchmark is done.
+func (self *Benchmark) cleanup(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	_, err := self.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(self.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		log.Printf("delete %q: %v", key, err)
+	}
+}
+
+// report prints throughput and latency percentiles of op.
+func (self *Benchmark) report(op string, durations []time.Duration) {
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	bytesPerSec := float64(self.size) * float64(len(durations)) /
+		total.Seconds()
+	rate, suffix := humanizeBytes(int64(bytesPerSec), true)
+
+	size, sizeSuffix := humanizeBytes(self.size, true)
+
+	slices.Sort(durations)
+	fmt.Printf("%-8s %d x %s %s: %s %s/s, p50 %v, p90 %v, p99 %v\n", op,
+		len(durations), size, sizeSuffix, rate, suffix,
+		percentile(durations, 50), percentile(durations, 90),
+		percentile(durations, 99))
+}
+
+// percentile returns p-th percentile of sorted durations, using nearest rank
+// method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	return sorted[max(i, 0)].Truncate(time.Millisecond)
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 10)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Second
+	}
+
+	tests := []struct {
+		sorted []time.Duration
+		p      int
+		want   time.Duration
+	}{
+		{sorted: nil, p: 50, want: 0},
+		{sorted: sorted[:1], p: 50, want: time.Second},
+		{sorted: sorted, p: 0, want: time.Second},
+		{sorted: sorted, p: 50, want: 5 * time.Second},
+		{sorted: sorted, p: 90, want: 9 * time.Second},
+		{sorted: sorted, p: 95, want: 10 * time.Second},
+		{sorted: sorted, p: 100, want: 10 * time.Second},
+		{
+			sorted: []time.Duration{1500 * time.Microsecond},
+			p:      50,
+			want:   time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		name := strconv.Itoa(len(tt.sorted)) + "/" + strconv.Itoa(tt.p)
+		t.Run(name, func(t *testing.T) {
+			if got := percentile(tt.sorted, tt.p); got != tt.want {
+				t.Errorf("percentile(%v, %d) = %v, want %v", tt.sorted, tt.p, got,
+					tt.want)
+			}
+		})
+	}
+}
+
+func TestBenchmark_Run(t *testing.T) {
+	fake := newFakeS3(t)
+	b := NewBenchmark(fake.Client(), "bucket", 1<<10).WithCount(3)
+
+	stdout := captureStdout(t, func() {
+		if err := b.Run(context.Background()); err != nil {
+			t.Errorf("Run(): %v", err)
+		}
+	})
+
+	counts := make(map[string]int)
+	for _, req := range fake.Requests() {
+		method, _, _ := strings.Cut(req, " ")
+		counts[method]++
+	}
+	if counts["PUT"] != 3 || counts["GET"] != 3 || counts["DELETE"] != 1 {
+		t.Errorf("requests %v, want 3 PUT, 3 GET and 1 DELETE", counts)
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("%d objects left after benchmark", len(fake.objects))
+	}
+
+	for _, op := range []string{"upload", "download"} {
+		re := regexp.MustCompile(`(?m)^` + op +
+			` +3 x 1\.0 KiB: [0-9.]+ \S+/s, p50 .+, p90 .+, p99 .+$`)
+		if !re.MatchString(stdout) {
+			t.Errorf("no %s report in %q", op, stdout)
+		}
+	}
+}
+
+// captureStdout returns everything fn printed to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	return captureFile(t, &os.Stdout, fn)
+}
+
+// captureStderr returns everything fn printed to stderr.
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	return captureFile(t, &os.Stderr, fn)
+}
+
+// captureFile returns everything fn wrote to *f.
+func captureFile(t *testing.T, f **os.File, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	orig := *f
+	*f = w
+	fn()
+	*f = orig
+	w.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -2,52 +2,691 @@ package cmd
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
+	"mime"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/spf13/cobra"
+
+	"github.com/dsh2dsh/expx-dbcopy/internal/retry"
 )
 
-var catCmd = cobra.Command{
-	Use:                   "cat -b my-bucket name",
-	Short:                 "Output name.bz2.crypt to stdout",
-	Args:                  cobra.ExactArgs(1),
-	DisableFlagsInUseLine: true,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := rootSetup(); err != nil {
-			return err
-		}
-		return NewCat(s3Client, s3Bucket).Run(context.Background(), args[0])
-	},
+const (
+	checksumExt    = ".sha256"
+	headRetryDelay = 500 * time.Millisecond
+
+	// Big dumps can take hours to download. Without --command-timeout cat
+	// limits download time by catTimeout, and extends it for objects, which
+	// can't be downloaded in catTimeout at catTimeoutRate bytes per second.
+	catTimeout     = 12 * time.Hour
+	catTimeoutRate = 1 << 20
+
+	onMissingError = "error"
+	onMissingWait  = "wait"
+
+	// exitPartial is exit code of truncated download with --partial-ok.
+	exitPartial = 10
+	// exitUnchanged is exit code of not modified object with --if-none-match.
+	exitUnchanged = 11
+
+	hashSHA256 = "sha256"
+	hashMD5    = "md5"
+)
+
+var (
+	catCmd = cobra.Command{
+		Use:                   "cat -b my-bucket [--on-missing wait [-t timeout]] [-o file [--write-checksum]] name",
+		Short:                 "Output name.bz2.crypt to stdout",
+		Args:                  cobra.ExactArgs(1),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := rootSetup(); err != nil {
+				return err
+			}
+
+			if catWriteChecksum && catOutput == "" {
+				return errors.New("--write-checksum requires --output")
+			}
+
+			c := NewCat(s3Client, s3Bucket).
+				WithOutput(catOutput, catWriteChecksum).
+				WithHeadRetries(catHeadRetries).
+				WithChecksumWarnOnly(catChecksumWarn).
+				WithForce(catForce).
+				WithRequireOk(catRequireOk, catMinAge).
+				WithAllowEmpty(allowEmpty).
+				WithRetries(catMaxRetries, catRetryFor).
+				WithFollowRedirects(catRedirects).
+				WithWireDecode(catWireDecode).
+				WithContentType(catContentType).
+				WithPartialOk(catPartialOk).
+				WithIfNoneMatch(catIfNoneMatch).
+				WithCompare(catCompare).
+				WithOutputNull(catOutputNull).
+				WithRetryChecksum(catRetryChecksum)
+			if catManifest {
+				c.WithManifest(objectName(args[0])+manifestExt, catVerify,
+					catContinueOnErr)
+			} else if catVerify || catContinueOnErr {
+				return errors.New("--verify and --continue-on-error require --manifest")
+			}
+			switch catOnMissing {
+			case onMissingError:
+			case onMissingWait:
+				c.WithWaitMissing(catWaitMax)
+			default:
+				return fmt.Errorf("unexpected --on-missing=%q, expected %q or %q",
+					catOnMissing, onMissingError, onMissingWait)
+			}
+
+			if err := c.WithOutputChecksum(catOutputHash); err != nil {
+				return err
+			}
+
+			if catConcurrency > 1 || catPartWorkers > 1 {
+				n, err := parseBytes(catReorderBuffer)
+				if err != nil {
+					return fmt.Errorf("parse --reorder-buffer: %w", err)
+				}
+				c.WithConcurrency(catConcurrency, n).
+					WithPartConcurrency(catPartWorkers, n)
+			}
+
+			if catMinRate != "" {
+				if catConcurrency > 1 || catPartWorkers > 1 {
+					return errors.New(
+						"--min-rate can't be used with --concurrency or --part-concurrency")
+				}
+				rate, err := parseBytes(catMinRate)
+				if err != nil {
+					return fmt.Errorf("parse --min-rate: %w", err)
+				}
+				c.WithMinRate(rate, catRateWindow)
+			}
+
+			if catOutputFd >= 0 {
+				f, err := outputFd(catOutputFd)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				c.WithStdout(f)
+			}
+
+			sock, err := listenProgress(progressSocketPath)
+			if err != nil {
+				return err
+			}
+			defer sock.Close()
+
+			var ctx context.Context
+			var cancel context.CancelFunc
+			if commandTimeout > 0 {
+				ctx, cancel = commandContext(catTimeout)
+			} else {
+				ctx, cancel = context.WithCancel(context.Background())
+				c.WithSizeTimeout(true)
+			}
+			defer cancel()
+
+			name := objectName(args[0])
+			sock.Send(progressEvent{Event: "download", Name: name})
+			sock.Every(socketProgressInterval, func() progressEvent {
+				return progressEvent{
+					Event: "progress", Name: name, Size: c.Written(),
+				}
+			})
+			started := time.Now()
+			err = c.Run(ctx, name)
+			if catSummaryJSON {
+				sumErr := c.WriteSummary(os.Stderr, name, started, err)
+				if sumErr != nil {
+					// Keep error of the download, if summary failed too.
+					err = errors.Join(err, sumErr)
+				}
+			}
+			if err != nil {
+				sock.Send(progressEvent{
+					Event: "error", Name: name, Error: err.Error(),
+				})
+				silenceQuiet(cmd, err)
+				return err
+			}
+			sock.Send(progressEvent{Event: "ok", Name: name})
+			return nil
+		},
+	}
+
+	catOnMissing     string
+	catWaitMax       time.Duration
+	catOutput        string
+	catWriteChecksum bool
+	catHeadRetries   int
+	catChecksumWarn  bool
+	catForce         bool
+	catRequireOk     bool
+	catMinAge        time.Duration
+	catMaxRetries    int
+	catRetryFor      time.Duration
+	catRedirects     int
+	catOutputFd      int
+	catMinRate       string
+	catOutputHash    string
+	catConcurrency   int
+	catReorderBuffer string
+	catPartWorkers   int
+	catWireDecode    bool
+	catContentType   string
+	catPartialOk     bool
+	catManifest      bool
+	catVerify        bool
+	catContinueOnErr bool
+	catIfNoneMatch   string
+	catCompare       string
+	catOutputNull    bool
+	catRetryChecksum bool
+	catSummaryJSON   bool
+	catRateWindow    time.Duration
+)
+
+func init() {
+	catCmd.Flags().StringVar(&catOnMissing, "on-missing", onMissingError,
+		"what to do if the object doesn't exist: error or wait")
+	catCmd.Flags().DurationVarP(&catWaitMax, "timeout", "t", 30*time.Minute,
+		"wait timeout for --on-missing wait")
+	catCmd.Flags().StringVarP(&catOutput, "output", "o", "",
+		"write to file instead of stdout")
+	catCmd.Flags().BoolVar(&catWriteChecksum, "write-checksum", false,
+		"also write SHA-256 of the output into file.sha256")
+	catCmd.Flags().IntVar(&catHeadRetries, "head-retries", 0,
+		"head the object before download and retry this many times if not found")
+	catCmd.Flags().BoolVar(&catChecksumWarn, "checksum-warn-only", false,
+		"warn about checksum mismatch instead of failing")
+	catCmd.Flags().BoolVarP(&catForce, "force", "f", false,
+		"write binary output even if stdout is a terminal")
+	catCmd.Flags().BoolVar(&catRequireOk, "require-ok", false,
+		"download only if name.ok exists")
+	catCmd.Flags().DurationVar(&catMinAge, "min-age", 0,
+		"with --require-ok, name.ok must be newer than this age")
+	catCmd.Flags().BoolVar(&allowEmpty, "allow-empty", false,
+		"accept empty name.bz2.crypt")
+	catCmd.Flags().IntVar(&catMaxRetries, "max-retries", 0,
+		"resume interrupted download up to this many times")
+	catCmd.Flags().DurationVar(&catRetryFor, "retry-for", 0,
+		"resume interrupted download, until total delay between retries exceeds it")
+	catCmd.Flags().IntVar(&catRedirects, "follow-redirects", 0,
+		"follow up to this many redirects of any kind, while getting the object")
+	catCmd.Flags().IntVar(&catOutputFd, "output-fd", -1,
+		"write to this already open file descriptor instead of stdout")
+	catCmd.MarkFlagsMutuallyExclusive("output", "output-fd")
+	catCmd.Flags().StringVar(&catMinRate, "min-rate", "",
+		"interrupt download slower than this per second, like 1MiB")
+	catCmd.Flags().DurationVar(&catRateWindow, "min-rate-window", time.Minute,
+		"measure --min-rate during this window")
+	catCmd.Flags().StringVar(&catOutputHash, "print-output-checksum", "",
+		"print checksum of the output to stderr: sha256 or md5")
+	catCmd.Flags().Lookup("print-output-checksum").NoOptDefVal = hashSHA256
+	catCmd.Flags().IntVarP(&catConcurrency, "concurrency", "c", 1,
+		"download this many ranges concurrently")
+	catCmd.Flags().IntVar(&catPartWorkers, "part-concurrency", 1,
+		"download this many parts of multipart object concurrently")
+	catCmd.MarkFlagsMutuallyExclusive("concurrency", "part-concurrency")
+	catCmd.Flags().StringVar(&catReorderBuffer, "reorder-buffer", "64MiB",
+		"with --concurrency or --part-concurrency, buffer up to this size of "+
+			"out of order chunks and download no more chunks, than fit it")
+	catCmd.Flags().BoolVar(&catWireDecode, "wire-decode", false,
+		"accept gzip encoded response and decode it, for compressing gateways")
+	catCmd.MarkFlagsMutuallyExclusive("wire-decode", "concurrency",
+		"part-concurrency")
+	catCmd.Flags().StringVar(&catContentType, "expected-content-type", "",
+		"fail, if Content-Type of the object isn't this")
+	catCmd.Flags().BoolVar(&catPartialOk, "partial-ok", false,
+		"exit with code 10, instead of 1, if download is truncated")
+	catCmd.Flags().BoolVar(&catManifest, "manifest", false,
+		"output all parts listed in name.sha256sums, instead of name.bz2.crypt")
+	catCmd.Flags().BoolVar(&catVerify, "verify", false,
+		"with --manifest, check size and checksum of every part")
+	catCmd.Flags().BoolVar(&catContinueOnErr, "continue-on-error", false,
+		"with --verify, output all parts, even if some of them mismatch")
+	catCmd.Flags().StringVar(&catIfNoneMatch, "if-none-match", "",
+		"download only if ETag of the object isn't this, else exit with code 11")
+	catCmd.MarkFlagsMutuallyExclusive("if-none-match", "concurrency",
+		"part-concurrency")
+	catCmd.MarkFlagsMutuallyExclusive("if-none-match", "manifest")
+	catCmd.Flags().StringVar(&catCompare, "compare", "",
+		"compare the object with this local file, instead of output")
+	catCmd.MarkFlagsMutuallyExclusive("compare", "output", "output-fd",
+		"manifest")
+	catCmd.Flags().BoolVar(&catOutputNull, "output-null", false,
+		"discard downloaded content and report download rate")
+	catCmd.MarkFlagsMutuallyExclusive("output-null", "output", "output-fd",
+		"compare")
+	catCmd.Flags().BoolVar(&catRetryChecksum, "retry-on-checksum-mismatch",
+		false, "download again on checksum mismatch, using --max-retries, "+
+			"--retry-for and output file")
+	catCmd.MarkFlagsMutuallyExclusive("retry-on-checksum-mismatch",
+		"checksum-warn-only")
+	catCmd.Flags().BoolVar(&catSummaryJSON, "summary-json", false,
+		"print one line JSON summary to stderr on completion")
 }
 
 func NewCat(client *s3.Client, bucket string) *Cat {
-	return &Cat{client: client, bucket: bucket}
+	return &Cat{client: client, bucket: bucket, stdout: os.Stdout}
 }
 
 type Cat struct {
-	client *s3.Client
-	bucket string
+	client  *s3.Client
+	bucket  string
+	waitMax time.Duration
+
+	output        string
+	writeChecksum bool
+	headRetries   int
+
+	checksumWarnOnly bool
+	force            bool
+
+	requireOk  bool
+	okMaxAge   time.Duration
+	allowEmpty bool
+
+	maxRetries int
+	retryFor   time.Duration
+
+	httpClient *http.Client
+	stdout     *os.File
+
+	minRate    int64
+	rateWindow time.Duration
+
+	outHash    hash.Hash
+	outHashAlg string
+
+	concurrency     int
+	partConcurrency int
+	reorderBuffer   int64
+
+	wireDecode bool
+
+	contentType string
+	partialOk   bool
+
+	manifest        string
+	verifyParts     bool
+	continueOnError bool
+
+	ifNoneMatch string
+	compare     string
+	outputNull  bool
+
+	retryChecksum bool
+	sizeTimeout   bool
+	deadline      *time.Timer
+	deadlineSized bool
+
+	written  atomic.Int64
+	verified bool
+}
+
+// Written returns number of bytes written so far. It's safe to call
+// concurrently with Run.
+func (self *Cat) Written() int64 { return self.written.Load() }
+
+// WithIfNoneMatch configures Cat to download the object, only if its ETag
+// isn't etag. Otherwise it returns exitError with exitUnchanged code and
+// outputs nothing.
+func (self *Cat) WithIfNoneMatch(etag string) *Cat {
+	self.ifNoneMatch = etag
+	return self
+}
+
+// WithPartialOk configures Cat to return exitError with exitPartial code, if
+// download is truncated and can't be resumed, so wrappers can decide whether
+// the partial output is usable. Everything downloaded is written anyway.
+func (self *Cat) WithPartialOk(v bool) *Cat {
+	self.partialOk = v
+	return self
+}
+
+// WithContentType configures Cat to check Content-Type of the object is
+// contentType before download, so a wrong object isn't restored. Parameters
+// of media type, like charset, are ignored. The check is skipped with
+// WithForce.
+func (self *Cat) WithContentType(contentType string) *Cat {
+	self.contentType = contentType
+	return self
+}
+
+func (self *Cat) checkContentType(key string, got *string) error {
+	if self.contentType == "" || self.force {
+		return nil
+	}
+
+	want, _, _ := mime.ParseMediaType(self.contentType)
+	have, _, _ := mime.ParseMediaType(aws.ToString(got))
+	if want != have || want == "" {
+		return fmt.Errorf(
+			"unexpected Content-Type of %q: %q, expected %q, use --force to override",
+			key, aws.ToString(got), self.contentType)
+	}
+	return nil
+}
+
+// WithOutputChecksum configures Cat to print checksum of everything it wrote
+// to stderr, using alg: sha256 or md5.
+func (self *Cat) WithOutputChecksum(alg string) error {
+	switch alg {
+	case "":
+		self.outHash = nil
+	case hashSHA256:
+		self.outHash = sha256.New()
+	case hashMD5:
+		self.outHash = md5.New()
+	default:
+		return fmt.Errorf("unexpected checksum algorithm %q, expected %q or %q",
+			alg, hashSHA256, hashMD5)
+	}
+	self.outHashAlg = alg
+	return nil
+}
+
+// WithStdout configures Cat to write into f, instead of stdout, if it isn't
+// configured to write into file.
+func (self *Cat) WithStdout(f *os.File) *Cat {
+	self.stdout = f
+	return self
+}
+
+// WithFollowRedirects configures Cat to follow up to n redirects of any kind,
+// while it gets the object, for buckets behind redirecting proxies or
+// gateways. By default the SDK follows 307 and 308 redirects only.
+func (self *Cat) WithFollowRedirects(n int) *Cat {
+	if n > 0 {
+		self.httpClient = redirectClient(n)
+	} else {
+		self.httpClient = nil
+	}
+	return self
+}
+
+// WithRetries configures Cat to resume interrupted download up to n times,
+// or until total delay between retries exceeds d, whichever comes first. If
+// n is zero, but d isn't, it retries until d exceeds.
+func (self *Cat) WithRetries(n int, d time.Duration) *Cat {
+	self.maxRetries = n
+	self.retryFor = d
+	return self
+}
+
+// WithAllowEmpty configures Cat to accept empty object. By default it's an
+// error.
+func (self *Cat) WithAllowEmpty(v bool) *Cat {
+	self.allowEmpty = v
+	return self
+}
+
+// WithRequireOk configures Cat to download only if name.ok exists, so
+// nothing is downloaded before the producer completed. If maxAge isn't zero,
+// name.ok must be not older than that.
+func (self *Cat) WithRequireOk(v bool, maxAge time.Duration) *Cat {
+	self.requireOk = v
+	self.okMaxAge = maxAge
+	return self
+}
+
+// WithForce allows Cat to write binary output to terminal.
+func (self *Cat) WithForce(v bool) *Cat {
+	self.force = v
+	return self
+}
+
+// WithChecksumWarnOnly configures Cat to only warn about checksum mismatch
+// and output everything it downloaded, instead of failing.
+func (self *Cat) WithChecksumWarnOnly(v bool) *Cat {
+	self.checksumWarnOnly = v
+	return self
+}
+
+// WithHeadRetries configures Cat to head the object before download and
+// retry up to n times, if it's not found, because some backends don't see
+// just uploaded object for a short time.
+func (self *Cat) WithHeadRetries(n int) *Cat {
+	self.headRetries = n
+	return self
+}
+
+// WithOutput configures Cat to write into file named fname, instead of
+// stdout. If checksum is true, it also writes SHA-256 of the content into
+// fname.sha256.
+func (self *Cat) WithOutput(fname string, checksum bool) *Cat {
+	self.output = fname
+	self.writeChecksum = checksum
+	return self
+}
+
+// WithOutputNull configures Cat to discard downloaded content, instead of
+// writing it anywhere, and log download rate. All checks of the content are
+// still made.
+func (self *Cat) WithOutputNull(v bool) *Cat {
+	self.outputNull = v
+	return self
+}
+
+// WithSizeTimeout configures Cat to limit download time by catTimeout,
+// extended by catSizeTimeout, when size of the object is known. Waiting for
+// the object and heading it are limited by setupTimeout and wait timeout.
+func (self *Cat) WithSizeTimeout(v bool) *Cat {
+	self.sizeTimeout = v
+	return self
+}
+
+// catSizeTimeout returns download time of object with size bytes at
+// catTimeoutRate.
+func catSizeTimeout(size int64) time.Duration {
+	return time.Duration(size/catTimeoutRate) * time.Second
+}
+
+// extendTimeout extends download timeout, configured by WithSizeTimeout, if
+// catTimeout isn't enough for size bytes. Only the first known size is used.
+func (self *Cat) extendTimeout(size int64) {
+	if self.deadline == nil || self.deadlineSized {
+		return
+	}
+	self.deadlineSized = true
+	if d := catSizeTimeout(size); d > catTimeout {
+		log.Println("download timeout:", d)
+		self.deadline.Reset(d)
+	}
+}
+
+// WithWaitMissing configures Cat to wait up to d for the object to appear,
+// instead of returning not found error.
+func (self *Cat) WithWaitMissing(d time.Duration) *Cat {
+	self.waitMax = d
+	return self
 }
 
 func (self *Cat) Run(ctx context.Context, name string) error {
 	key := name + sqlExt
+	h, err := self.prepare(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if self.sizeTimeout {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		self.deadline = time.AfterFunc(catTimeout, func() {
+			cancel(errCatTimeout)
+		})
+		defer self.deadline.Stop()
+		if h != nil {
+			self.extendTimeout(aws.ToInt64(h.ContentLength))
+		}
+	}
+
+	if self.manifest != "" {
+		return self.runManifest(ctx)
+	}
+
+	if self.compare != "" {
+		log.Println("compare", key, "with", self.compare)
+		return self.compareWith(ctx, key)
+	}
+
 	log.Println("download", key)
-	resp, err := self.client.GetObject(ctx, &s3.GetObjectInput{
+	err = self.writeTo(func(w io.Writer) error {
+		return self.download(ctx, key, w)
+	})
+	if err != nil {
+		return err
+	}
+	return self.printOutputChecksum(key)
+}
+
+// prepare waits for the object of name, checks its name.ok and heads it,
+// whatever is configured. It returns head of the object, if it's known.
+func (self *Cat) prepare(ctx context.Context, name string,
+) (h *s3.HeadObjectOutput, err error) {
+	if self.sizeTimeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, self.waitMax+setupTimeout)
+		defer cancel()
+	}
+
+	key := name + sqlExt
+	if self.waitMax > 0 {
+		log.Println("wait for", key)
+		h, err = waitObjectExists(ctx, self.client, self.bucket, key,
+			self.waitMax, func(o *s3.ObjectExistsWaiterOptions) {
+				o.ClientOptions = append(o.ClientOptions, self.getOptions()...)
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if self.requireOk {
+		if err := self.checkOk(ctx, name+okExt); err != nil {
+			return nil, err
+		}
+	}
+
+	if self.manifest != "" {
+		return nil, nil
+	} else if self.headRetries > 0 {
+		h, err = self.headObject(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		size, suffix := humanizeBytes(aws.ToInt64(h.ContentLength), true)
+		log.Println("object size:", size, suffix)
+	}
+	return h, nil
+}
+
+// writeTo calls fn with configured output: file or stdout.
+func (self *Cat) writeTo(fn func(w io.Writer) error) error {
+	if self.output != "" {
+		return self.writeOutput(fn)
+	} else if self.outputNull {
+		return writeNull(fn)
+	}
+
+	var w io.Writer = self.stdout
+	if !self.force && isTerminal(self.stdout) {
+		w = &binaryGuard{w: w}
+	}
+	return fn(w)
+}
+
+// printOutputChecksum prints checksum of the output in the same format as
+// sha256sum(1) and md5sum(1), with algorithm name in front of it.
+func (self *Cat) printOutputChecksum(key string) error {
+	if self.outHash == nil {
+		return nil
+	}
+	_, err := fmt.Fprintf(os.Stderr, "%s: %s  %s\n", self.outHashAlg,
+		hex.EncodeToString(self.outHash.Sum(nil)), key)
+	if err != nil {
+		return fmt.Errorf("print output checksum: %w", err)
+	}
+	return nil
+}
+
+func (self *Cat) headObject(ctx context.Context, key string,
+) (h *s3.HeadObjectOutput, err error) {
+	policy := retry.Policy{
+		Attempts:  self.headRetries + 1,
+		BaseDelay: headRetryDelay,
+		Jitter:    0.2,
+		Notify: func(err error, delay time.Duration) {
+			log.Printf("%q not found, retry in %v", key, delay.Truncate(time.Millisecond))
+		},
+	}
+
+	err = retry.Do(ctx, policy, func(ctx context.Context) (err error) {
+		h, err = self.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(self.bucket),
+			Key:    aws.String(key),
+		}, self.getOptions()...)
+		var notFound *types.NotFound
+		if err != nil && !errors.As(err, &notFound) {
+			return retry.Permanent(err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("heading %q: %w", key, err)
+	}
+	return h, nil
+}
+
+func (self *Cat) checkOk(ctx context.Context, key string) error {
+	h, err := self.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(self.bucket),
 		Key:    aws.String(key),
-	})
+	}, self.getOptions()...)
 	if err != nil {
-		return fmt.Errorf("read %q: %w", key, err)
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return fmt.Errorf("not yet complete: %q not found", key)
+		}
+		return fmt.Errorf("heading %q: %w", key, err)
+	}
+
+	if self.okMaxAge > 0 {
+		age := time.Since(aws.ToTime(h.LastModified))
+		if age > self.okMaxAge {
+			return fmt.Errorf("stale dump: %q is %v old, expected newer than %v",
+				key, age.Truncate(time.Second), self.okMaxAge)
+		}
 	}
-	defer resp.Body.Close()
+	return nil
+}
 
-	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
-		return fmt.Errorf("copy %q to stdout: %w", key, err)
+// writeChecksumFile writes sum of fname into fname.sha256, using the same
+// format as sha256sum(1), so it can be verified by sha256sum -c.
+func writeChecksumFile(fname string, sum []byte) error {
+	line := hex.EncodeToString(sum) + "  " + filepath.Base(fname) + "\n"
+	err := os.WriteFile(fname+checksumExt, []byte(line), 0o644)
+	if err != nil {
+		return fmt.Errorf("write checksum of %q: %w", fname, err)
 	}
 	return nil
 }
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// WithCompare configures Cat to compare the object with local file fname
+// byte by byte, instead of writing it anywhere.
+func (self *Cat) WithCompare(fname string) *Cat {
+	self.compare = fname
+	return self
+}
+
+func (self *Cat) compareWith(ctx context.Context, key string) error {
+	f, err := os.Open(self.compare)
+	if err != nil {
+		return fmt.Errorf("open %q: %w", self.compare, err)
+	}
+	defer f.Close()
+
+	cw := &compareWriter{r: bufio.NewReader(f)}
+	if err := self.download(ctx, key, cw); err != nil {
+		return err
+	} else if err := cw.Rest(); err != nil {
+		return fmt.Errorf("%q differs from %q: %w", key, self.compare, err)
+	}
+	log.Printf("✓ %q matches %q", key, self.compare)
+	return nil
+}
+
+var errContentDiffers = errors.New("content differs")
+
+// compareWriter compares everything written into it with content of r.
+type compareWriter struct {
+	r   io.Reader
+	buf []byte
+	off int64
+}
+
+func (self *compareWriter) Write(p []byte) (int, error) {
+	if cap(self.buf) < len(p) {
+		self.buf = make([]byte, len(p))
+	}
+	buf := self.buf[:len(p)]
+
+	n, err := io.ReadFull(self.r, buf)
+	if i := mismatchIndex(p[:n], buf[:n]); i >= 0 {
+		return 0, fmt.Errorf("%w at byte %d", errContentDiffers, self.off+int64(i))
+	} else if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, fmt.Errorf("%w: local file is shorter, %d bytes",
+			errContentDiffers, self.off+int64(n))
+	} else if err != nil {
+		return 0, fmt.Errorf("read local file: %w", err)
+	}
+	self.off += int64(n)
+	return n, nil
+}
+
+// Rest returns an error, if local file has more content, than was written.
+func (self *compareWriter) Rest() error {
+	var b [1]byte
+	if _, err := self.r.Read(b[:]); errors.Is(err, io.EOF) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read local file: %w", err)
+	}
+	return fmt.Errorf("%w: local file is longer, than %d bytes",
+		errContentDiffers, self.off)
+}
+
+func mismatchIndex(a, b []byte) int {
+	if bytes.Equal(a, b) {
+		return -1
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return -1
+}
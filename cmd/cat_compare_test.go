@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		local   string
+		writes  []string
+		wantErr string
+	}{
+		{name: "equal", local: "foobar", writes: []string{"foo", "bar"}},
+		{
+			name:    "differs",
+			local:   "foobaz",
+			writes:  []string{"foo", "bar"},
+			wantErr: "at byte 5",
+		},
+		{
+			name:    "local shorter",
+			local:   "foob",
+			writes:  []string{"foo", "bar"},
+			wantErr: "local file is shorter, 4 bytes",
+		},
+		{
+			name:    "local longer",
+			local:   "foobarbaz",
+			writes:  []string{"foo", "bar"},
+			wantErr: "local file is longer, than 6 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cw := &compareWriter{r: strings.NewReader(tt.local)}
+			var err error
+			for _, s := range tt.writes {
+				if _, err = cw.Write([]byte(s)); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = cw.Rest()
+			}
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("compare: %v", err)
+				}
+			} else if !errors.Is(err, errContentDiffers) ||
+				!strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("compare = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCat_compare(t *testing.T) {
+	tests := []struct {
+		name    string
+		local   string
+		wantErr bool
+	}{
+		{name: "matches", local: "content"},
+		{name: "differs", local: "contents", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+			local := filepath.Join(t.TempDir(), "foo.sql")
+			if err := os.WriteFile(local, []byte(tt.local), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			err := NewCat(fake.Client(), "bucket").WithCompare(local).
+				Run(context.Background(), "foo")
+			if tt.wantErr && !errors.Is(err, errContentDiffers) {
+				t.Errorf("Run() = %v, want %v", err, errContentDiffers)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("Run(): %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,429 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/dsh2dsh/expx-dbcopy/internal/retry"
+)
+
+const (
+	resumeMinDelay = time.Second
+	resumeMaxDelay = 30 * time.Second
+)
+
+var errBinaryOutput = errors.New(
+	"refusing to write binary output to terminal, use --force to override")
+
+// writeOutput calls fn with configured output file. fn writes into temporary
+// file, which replaces the output, only if fn wrote something, so existing
+// output isn't truncated, if nothing was downloaded, like not modified object.
+func (self *Cat) writeOutput(fn func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(self.output),
+		"."+filepath.Base(self.output)+".*")
+	if err != nil {
+		return fmt.Errorf("create output: %w", err)
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	h := sha256.New()
+	cw := &countingWriter{w: &fileWriter{f: f}}
+	var w io.Writer = cw
+	if self.writeChecksum {
+		w = &hashWriter{w: w, h: h}
+	}
+
+	fnErr := fn(w)
+	if fnErr != nil && cw.n == 0 {
+		return fnErr
+	} else if err := f.Chmod(0o644); err != nil {
+		return fmt.Errorf("chmod %q: %w", f.Name(), err)
+	} else if err := f.Close(); err != nil {
+		return fmt.Errorf("close %q: %w", f.Name(), err)
+	} else if err := os.Rename(f.Name(), self.output); err != nil {
+		return fmt.Errorf("rename output: %w", err)
+	}
+
+	// Partial output is kept, but it has no checksum.
+	if fnErr != nil {
+		return fnErr
+	} else if self.writeChecksum {
+		return writeChecksumFile(self.output, h.Sum(nil))
+	}
+	return nil
+}
+
+// writeNull calls fn with writer, which discards everything, and logs
+// download rate.
+func writeNull(fn func(w io.Writer) error) error {
+	w := &countingWriter{w: io.Discard}
+	started := time.Now()
+	if err := fn(w); err != nil {
+		return err
+	}
+
+	elapsed := time.Since(started)
+	size, suffix := humanizeBytes(w.n, true)
+	rate, rateSuffix := humanizeBytes(
+		int64(float64(w.n)/max(elapsed.Seconds(), 0.001)), true)
+	log.Printf("discarded %s %s in %v: %s %s/s", size, suffix,
+		elapsed.Round(time.Millisecond), rate, rateSuffix)
+	return nil
+}
+
+// countingWriter counts written bytes. If total isn't nil, it's updated
+// too, so written bytes can be read concurrently.
+type countingWriter struct {
+	w     io.Writer
+	n     int64
+	total *atomic.Int64
+}
+
+func (self *countingWriter) Write(p []byte) (int, error) {
+	n, err := self.w.Write(p)
+	self.n += int64(n)
+	if self.total != nil {
+		self.total.Add(int64(n))
+	}
+	return n, err //nolint:wrapcheck // it's a proxy
+}
+
+func (self *countingWriter) Rewind() error {
+	if self.total != nil {
+		self.total.Add(-self.n)
+	}
+	self.n = 0
+	if self.w == io.Discard {
+		return nil
+	}
+	return rewind(self.w)
+}
+
+// download writes content of key into w. If it's interrupted by read error,
+// it resumes from the last written byte, using configured retries.
+func (self *Cat) download(ctx context.Context, key string, w io.Writer) error {
+	w = &countingWriter{w: w, total: &self.written}
+
+	if self.outHash != nil {
+		w = &hashWriter{w: w, h: self.outHash}
+	}
+
+	if self.partConcurrency > 1 {
+		return self.copyError(self.downloadParts(ctx, key, w))
+	} else if self.concurrency > 1 {
+		return self.copyError(self.downloadRanges(ctx, key, w))
+	}
+	return self.downloadStream(ctx, key, w)
+}
+
+// downloadStream downloads key by single request and resumes it, if it's
+// interrupted.
+func (self *Cat) downloadStream(ctx context.Context, key string, w io.Writer,
+) error {
+	var offset int64
+	var etag *string
+	total, writeFailed := int64(-1), false
+
+	var stored string
+	if self.wireDecode {
+		s, err := self.storedEncoding(ctx, key)
+		if err != nil {
+			return err
+		}
+		stored = s
+	}
+
+	err := retry.Do(ctx, self.retryPolicy(key), func(ctx context.Context) error {
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+
+		resp, err := self.getObject(ctx, key, offset, etag)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		size := int64(-1)
+		if resp.ContentLength != nil {
+			size = *resp.ContentLength
+		}
+		body := self.watchRate(ctx, cancel, resp.Body, size)
+		if self.wireDecode && offset == 0 {
+			// Resumed download doesn't accept gzip, because range of encoded
+			// content isn't a range of the object.
+			body, err = wireDecoder(aws.ToString(resp.ContentEncoding), stored,
+				body)
+			if err != nil {
+				return err
+			}
+		}
+
+		if offset > 0 {
+			// Checksum of a range isn't checksum of the whole object.
+			self.verified = false
+		} else {
+			etag = resp.ETag
+			self.verified = !self.wireDecode && validatedChecksum(resp)
+			if err := self.checkContentType(key, resp.ContentType); err != nil {
+				return retry.Permanent(err)
+			}
+			if resp.ContentLength != nil {
+				total = *resp.ContentLength
+				self.extendTimeout(total)
+				err := checkEmpty(key, *resp.ContentLength, self.allowEmpty)
+				if err != nil {
+					return retry.Permanent(err)
+				}
+			}
+		}
+
+		out := outputWriter{w: w}
+		n, err := io.Copy(&out, body)
+		offset += n
+		if err == nil {
+			return nil
+		} else if cause := context.Cause(ctx); errors.Is(cause, errSlowDownload) {
+			return cause
+		} else if out.err != nil {
+			writeFailed = true
+			return retry.Permanent(fmt.Errorf("copy: %w", err))
+		} else if isChecksumMismatch(err) {
+			return self.checksumMismatch(w, &offset, err)
+		}
+		return fmt.Errorf("read: %w", err)
+	})
+	if err != nil {
+		err = fmt.Errorf("download %q: %w", key, err)
+		if self.retryChecksum && isChecksumMismatch(err) {
+			err = fmt.Errorf("stored object is probably corrupted: %w", err)
+		}
+		// Size of wire decoded content isn't known.
+		if self.partialOk && !writeFailed && offset > 0 && offset < total &&
+			!self.wireDecode {
+			return &exitError{
+				code: exitPartial,
+				err: fmt.Errorf("truncated after %d of %d bytes: %w",
+					offset, total, err),
+			}
+		}
+		return self.copyError(err)
+	}
+	return nil
+}
+
+// checksumMismatch returns permanent error err, unless Cat configured to
+// download again on checksum mismatch. In this case it rewinds w and resets
+// offset, so the next attempt starts over.
+func (self *Cat) checksumMismatch(w io.Writer, offset *int64, err error,
+) error {
+	err = fmt.Errorf("copy: %w", err)
+	if !self.retryChecksum {
+		return retry.Permanent(err)
+	} else if rwErr := rewind(w); rwErr != nil {
+		return retry.Permanent(fmt.Errorf("download again: %w",
+			errors.Join(err, rwErr)))
+	}
+	*offset = 0
+	return err
+}
+
+func (self *Cat) retryPolicy(key string) retry.Policy {
+	policy := retry.Policy{
+		Attempts:  1,
+		BaseDelay: resumeMinDelay,
+		MaxDelay:  resumeMaxDelay,
+		Jitter:    0.2,
+		Budget:    self.retryFor,
+		Notify: func(err error, delay time.Duration) {
+			log.Printf("download %q interrupted: %v, resume in %v", key, err,
+				delay.Truncate(time.Millisecond))
+		},
+	}
+
+	if self.maxRetries > 0 {
+		policy.Attempts = self.maxRetries + 1
+	} else if self.retryFor > 0 {
+		policy.Attempts = 0
+	}
+	return policy
+}
+
+// getObject gets key from offset. Resumed download uses If-Match with ETag of
+// the first response, so it fails if the object was replaced meanwhile.
+func (self *Cat) getObject(ctx context.Context, key string, offset int64,
+	etag *string,
+) (*s3.GetObjectOutput, error) {
+	input := &s3.GetObjectInput{
+		Bucket:       aws.String(self.bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	}
+	if offset == 0 && self.ifNoneMatch != "" {
+		input.IfNoneMatch = aws.String(self.ifNoneMatch)
+	} else if offset > 0 {
+		// Checksum of whole object can't be validated by a range of it.
+		input.ChecksumMode = ""
+		input.Range = aws.String("bytes=" + strconv.FormatInt(offset, 10) + "-")
+		input.IfMatch = etag
+	}
+
+	opts := self.getOptions()
+	if self.wireDecode && offset == 0 {
+		// Checksum is of the stored content, not of encoded one.
+		input.ChecksumMode = ""
+		opts = append(opts, s3.WithAPIOptions(acceptGzip))
+	}
+
+	resp, err := self.client.GetObject(ctx, input, opts...)
+	if err != nil {
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) &&
+			respErr.HTTPStatusCode() == http.StatusNotModified {
+			log.Printf("%q not modified", key)
+			return nil, retry.Permanent(&exitError{
+				code:  exitUnchanged,
+				err:   fmt.Errorf("%q not modified: %w", key, err),
+				quiet: true,
+			})
+		}
+		return nil, permanentClientError(fmt.Errorf("read %q: %w", key, err))
+	}
+	return resp, nil
+}
+
+// permanentClientError returns err as permanent for retry.Do, if it's client
+// error, like not found or access denied, which won't fix by itself.
+// Everything else is retried by the SDK already, but we try again, because we
+// already have a part of the object.
+func permanentClientError(err error) error {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) &&
+		respErr.HTTPStatusCode() < http.StatusInternalServerError {
+		return retry.Permanent(err)
+	}
+	return err
+}
+
+func (self *Cat) getOptions() []func(*s3.Options) {
+	if self.httpClient == nil {
+		return nil
+	}
+	return []func(*s3.Options){
+		func(o *s3.Options) { o.HTTPClient = self.httpClient },
+	}
+}
+
+// redirectClient returns HTTP client, which follows up to n redirects of any
+// kind, unlike the SDK's default client, which follows 307 and 308 only. It
+// stops on redirect loop.
+func redirectClient(n int) *http.Client {
+	return &http.Client{
+		Transport: awshttp.NewBuildableClient().GetTransport(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > n {
+				return fmt.Errorf("stopped after %d redirects", n)
+			}
+			loc := req.URL.String()
+			for _, r := range via {
+				if r.URL.String() == loc {
+					return fmt.Errorf("redirect loop to %q", loc)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// copyError returns err, unless it's checksum mismatch and Cat configured to
+// only warn about it.
+func (self *Cat) copyError(err error) error {
+	if self.checksumWarnOnly && isChecksumMismatch(err) {
+		self.verified = false
+		log.Println("WARNING: output is corrupted:", err)
+		return nil
+	}
+	return err
+}
+
+// isChecksumMismatch returns true if err is returned by response checksum
+// validation. It's from internal package of the SDK, so there is no error type
+// we can check.
+func isChecksumMismatch(err error) bool {
+	return strings.Contains(err.Error(), "checksum did not match")
+}
+
+// outputWriter remembers write errors, so we can tell them from read errors,
+// returned by io.Copy.
+type outputWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (self *outputWriter) Write(p []byte) (int, error) {
+	n, err := self.w.Write(p)
+	if err != nil {
+		self.err = err
+	}
+	return n, err //nolint:wrapcheck // it's a proxy
+}
+
+// binaryGuard fails the first write, if it doesn't look like text.
+type binaryGuard struct {
+	w       io.Writer
+	checked bool
+}
+
+func (self *binaryGuard) Write(p []byte) (int, error) {
+	if !self.checked {
+		self.checked = true
+		if looksBinary(p[:min(len(p), 512)]) {
+			return 0, errBinaryOutput
+		}
+	}
+	return self.w.Write(p) //nolint:wrapcheck // it's a proxy
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// looksBinary returns true, if b doesn't look like text.
+func looksBinary(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	} else if bytes.IndexByte(b, 0) >= 0 {
+		return true
+	}
+
+	// Don't fail on the last rune, truncated by the caller.
+	for i := len(b) - 1; i >= max(len(b)-utf8.UTFMax, 0); i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				b = b[:i]
+			}
+			break
+		}
+	}
+	return !utf8.Valid(b)
+}
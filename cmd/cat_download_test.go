@@ -0,0 +1,839 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCat_notModifiedKeepsOutput(t *testing.T) {
+	s3 := newFakeS3(t)
+	obj := s3.Put("bucket", "foo"+sqlExt, []byte("new content"))
+
+	output := filepath.Join(t.TempDir(), "foo.sql")
+	if err := os.WriteFile(output, []byte("cached"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCat(s3.Client(), "bucket").WithOutput(output, true).
+		WithIfNoneMatch(obj.ETag())
+	err := c.Run(context.Background(), "foo")
+
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Run() = %v, want exitError", err)
+	} else if exitErr.code != exitUnchanged || !exitErr.quiet {
+		t.Errorf("exitError = %+v, want quiet with code %d", exitErr,
+			exitUnchanged)
+	}
+
+	if b, err := os.ReadFile(output); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "cached" {
+		t.Errorf("output = %q, want it unchanged", b)
+	}
+	if _, err := os.Stat(output + checksumExt); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("checksum file: %v, want it doesn't exist", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(output)); len(entries) != 1 {
+		t.Errorf("%d files in output dir, want only output", len(entries))
+	}
+}
+
+func TestCat_modifiedReplacesOutput(t *testing.T) {
+	s3 := newFakeS3(t)
+	s3.Put("bucket", "foo"+sqlExt, []byte("new content"))
+
+	output := filepath.Join(t.TempDir(), "foo.sql")
+	if err := os.WriteFile(output, []byte("cached"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCat(s3.Client(), "bucket").WithOutput(output, false).
+		WithIfNoneMatch(`"outdated"`)
+	if err := c.Run(context.Background(), "foo"); err != nil {
+		t.Fatalf("Run(): %v", err)
+	}
+
+	if b, err := os.ReadFile(output); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "new content" {
+		t.Errorf("output = %q, want %q", b, "new content")
+	}
+}
+
+func TestCat_sizeTimeoutWithoutHead(t *testing.T) {
+	s3 := newFakeS3(t)
+	s3.Put("bucket", "foo"+sqlExt, []byte("content"))
+
+	c := NewCat(s3.Client(), "bucket").WithOutputNull(true).
+		WithSizeTimeout(true)
+	if err := c.Run(context.Background(), "foo"); err != nil {
+		t.Fatalf("Run(): %v", err)
+	}
+
+	want := "GET /bucket/foo" + sqlExt + "?x-id=GetObject"
+	if got := s3.Requests(); len(got) != 1 || got[0] != want {
+		t.Errorf("requests = %q, want only %q", got, want)
+	}
+	if !c.deadlineSized {
+		t.Error("timeout isn't extended by size of the object")
+	}
+}
+
+func TestCatSizeTimeout(t *testing.T) {
+	if d := catSizeTimeout(1 << 30); d >= catTimeout {
+		t.Errorf("catSizeTimeout(1GiB) = %v, want less than %v", d, catTimeout)
+	}
+	if d := catSizeTimeout(100 << 30); d <= catTimeout {
+		t.Errorf("catSizeTimeout(100GiB) = %v, want more than %v", d,
+			catTimeout)
+	}
+}
+
+func TestCat_followRedirects(t *testing.T) {
+	tests := []struct {
+		name string
+		cat  func(c *Cat) *Cat
+	}{
+		{name: "default", cat: func(c *Cat) *Cat { return c }},
+		{
+			name: "head retries",
+			cat:  func(c *Cat) *Cat { return c.WithHeadRetries(1) },
+		},
+		{
+			name: "wait missing",
+			cat:  func(c *Cat) *Cat { return c.WithWaitMissing(time.Minute) },
+		},
+		{
+			name: "require ok",
+			cat:  func(c *Cat) *Cat { return c.WithRequireOk(true, 0) },
+		},
+		{
+			name: "concurrency",
+			cat:  func(c *Cat) *Cat { return c.WithConcurrency(2, 1<<20) },
+		},
+		{
+			name: "part concurrency",
+			cat: func(c *Cat) *Cat {
+				return c.WithPartConcurrency(2, 1<<20)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3 := newFakeS3(t)
+			s3.Put("bucket", "foo"+sqlExt, []byte("content"))
+			s3.Put("bucket", "foo"+okExt, nil)
+			s3.Handler = func(w http.ResponseWriter, r *http.Request) bool {
+				rest, ok := strings.CutPrefix(r.URL.RequestURI(), "/mirror/")
+				if !ok {
+					return false
+				}
+				w.Header().Set("Location", "/bucket/"+rest)
+				w.WriteHeader(http.StatusFound)
+				return true
+			}
+
+			output := filepath.Join(t.TempDir(), "foo.sql")
+			c := tt.cat(NewCat(s3.Client(), "mirror").
+				WithOutput(output, false).WithFollowRedirects(1))
+			if err := c.Run(context.Background(), "foo"); err != nil {
+				t.Fatalf("Run(): %v", err)
+			}
+
+			if b, err := os.ReadFile(output); err != nil {
+				t.Fatal(err)
+			} else if string(b) != "content" {
+				t.Errorf("output = %q, want %q", b, "content")
+			}
+		})
+	}
+}
+
+func TestLooksBinary(t *testing.T) {
+	text := "SELECT 'привет';\n"
+	tests := []struct {
+		name string
+		b    string
+		want bool
+	}{
+		{name: "empty", b: "", want: false},
+		{name: "ascii", b: "SELECT 1;\n", want: false},
+		{name: "utf-8", b: text, want: false},
+		{name: "truncated trailing rune", b: text[:len(text)-6], want: false},
+		{name: "truncated 4 byte rune", b: "x \xf0\x9f\x98", want: false},
+		{name: "nul", b: "SELECT\x001;", want: true},
+		{name: "invalid utf-8", b: "SELECT \xff\xfe 1;", want: true},
+		{name: "invalid trailing byte", b: "SELECT 1;\xff", want: true},
+		{name: "lone continuation", b: "SELECT 1;\x80", want: true},
+		{name: "bzip2", b: "BZh91AY&SY\x8c\x1f\x00\x00", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksBinary([]byte(tt.b)); got != tt.want {
+				t.Errorf("looksBinary(%q) = %v, want %v", tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBinaryGuard(t *testing.T) {
+	tests := []struct {
+		name    string
+		writes  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "text", writes: []string{"SELECT 1;\n"}, want: "SELECT 1;\n"},
+		{name: "binary", writes: []string{"\x00\x01"}, wantErr: true},
+		{
+			// Only the first write is checked.
+			name:   "binary after text",
+			writes: []string{"SELECT 1;\n", "\x00\x01"},
+			want:   "SELECT 1;\n\x00\x01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := &binaryGuard{w: &buf}
+			var err error
+			for _, s := range tt.writes {
+				if _, err = w.Write([]byte(s)); err != nil {
+					break
+				}
+			}
+
+			if tt.wantErr {
+				if !errors.Is(err, errBinaryOutput) {
+					t.Errorf("Write() = %v, want %v", err, errBinaryOutput)
+				} else if buf.Len() != 0 {
+					t.Errorf("written %q, want nothing", buf.String())
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Write(): %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("written %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCat_waitMissing(t *testing.T) {
+	tests := []struct {
+		name     string
+		put      bool
+		waitMax  time.Duration
+		wantErr  string
+		wantHead bool
+	}{
+		{name: "exists", put: true, waitMax: time.Minute, wantHead: true},
+		{
+			name:     "missing",
+			waitMax:  100 * time.Millisecond,
+			wantErr:  `wait for "foo` + sqlExt + `"`,
+			wantHead: true,
+		},
+		{name: "no wait", wantErr: "NoSuchKey"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			if tt.put {
+				fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+			}
+
+			c := NewCat(fake.Client(), "bucket")
+			if tt.waitMax > 0 {
+				c.WithWaitMissing(tt.waitMax)
+			}
+			b, err := runCatErr(t, c)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Run(): %v", err)
+			case tt.wantErr != "" && (err == nil ||
+				!strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Run() = %v, want %q in it", err, tt.wantErr)
+			case tt.wantErr == "" && string(b) != "content":
+				t.Errorf("output %q, want %q", b, "content")
+			}
+
+			head := slices.ContainsFunc(fake.Requests(), func(s string) bool {
+				return strings.HasPrefix(s, "HEAD /bucket/foo"+sqlExt)
+			})
+			if head != tt.wantHead {
+				t.Errorf("object headed: %v, want %v", head, tt.wantHead)
+			}
+		})
+	}
+}
+
+func TestCat_writeChecksum(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+
+	output := filepath.Join(t.TempDir(), "foo.sql")
+	c := NewCat(fake.Client(), "bucket").WithOutput(output, true)
+	if err := c.Run(context.Background(), "foo"); err != nil {
+		t.Fatalf("Run(): %v", err)
+	}
+
+	b, err := os.ReadFile(output + checksumExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("content"))
+	// The same format as sha256sum(1), with the base name of the output.
+	want := hex.EncodeToString(sum[:]) + "  foo.sql\n"
+	if string(b) != want {
+		t.Errorf("checksum file %q, want %q", b, want)
+	}
+}
+
+func TestCat_headRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		failures  int32
+		retries   int
+		wantErr   bool
+		wantHeads int32
+	}{
+		{
+			name:      "propagated",
+			status:    http.StatusNotFound,
+			failures:  1,
+			retries:   2,
+			wantHeads: 2,
+		},
+		{
+			name:      "out of retries",
+			status:    http.StatusNotFound,
+			failures:  2,
+			retries:   1,
+			wantErr:   true,
+			wantHeads: 2,
+		},
+		{
+			name:      "forbidden",
+			status:    http.StatusForbidden,
+			failures:  1,
+			retries:   2,
+			wantErr:   true,
+			wantHeads: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+			var heads atomic.Int32
+			fake.Handler = func(w http.ResponseWriter, r *http.Request) bool {
+				if r.Method != http.MethodHead {
+					return false
+				} else if heads.Add(1) > tt.failures {
+					return false
+				}
+				w.WriteHeader(tt.status)
+				return true
+			}
+
+			b, err := runCatErr(t, NewCat(fake.Client(), "bucket").
+				WithHeadRetries(tt.retries))
+			if tt.wantErr && err == nil {
+				t.Error("Run() = nil, want error")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("Run(): %v", err)
+			} else if !tt.wantErr && string(b) != "content" {
+				t.Errorf("output %q, want %q", b, "content")
+			}
+			if got := heads.Load(); got != tt.wantHeads {
+				t.Errorf("headed %d times, want %d", got, tt.wantHeads)
+			}
+		})
+	}
+}
+
+// corruptChecksum makes fake to return wrong SHA-256 checksum of every object.
+func corruptChecksum(fake *fakeS3) {
+	sum := sha256.Sum256([]byte("other content"))
+	fake.Handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == http.MethodGet && r.Header.Get("Range") == "" {
+			w.Header().Set("X-Amz-Checksum-Sha256",
+				base64.StdEncoding.EncodeToString(sum[:]))
+		}
+		return false
+	}
+}
+
+func TestCat_checksumMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		warnOnly bool
+		wantErr  bool
+	}{
+		{name: "fail", wantErr: true},
+		{name: "warn only", warnOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+			corruptChecksum(fake)
+
+			b, err := runCatErr(t, NewCat(fake.Client(), "bucket").
+				WithChecksumWarnOnly(tt.warnOnly))
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Run(): %v", err)
+				} else if string(b) != "content" {
+					t.Errorf("output %q, want %q", b, "content")
+				}
+				return
+			}
+			if err == nil || !isChecksumMismatch(err) {
+				t.Errorf("Run() = %v, want checksum mismatch", err)
+			}
+		})
+	}
+}
+
+func TestCat_retryChecksum(t *testing.T) {
+	tests := []struct {
+		name       string
+		retry      bool
+		corruptAll bool
+		stdout     bool
+		wantErr    string
+	}{
+		{name: "retry ok", retry: true},
+		{name: "no retry", wantErr: "checksum"},
+		{
+			name:       "persistent",
+			retry:      true,
+			corruptAll: true,
+			wantErr:    "stored object is probably corrupted",
+		},
+		{
+			name:    "stdout",
+			retry:   true,
+			stdout:  true,
+			wantErr: errNotRewindable.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+			corruptChecksum(fake)
+			corrupt := fake.Handler
+			var gets int
+			fake.Handler = func(w http.ResponseWriter, r *http.Request) bool {
+				if r.Method == http.MethodGet {
+					gets++
+					if gets > 1 && !tt.corruptAll {
+						return false
+					}
+				}
+				return corrupt(w, r)
+			}
+
+			c := NewCat(fake.Client(), "bucket").WithRetryChecksum(tt.retry).
+				WithRetries(1, 0)
+			var b []byte
+			var err error
+			if tt.stdout {
+				stdout, createErr := os.Create(
+					filepath.Join(t.TempDir(), "stdout"))
+				if createErr != nil {
+					t.Fatal(createErr)
+				}
+				defer stdout.Close()
+				err = c.WithStdout(stdout).Run(context.Background(), "foo")
+			} else {
+				b, err = runCatErr(t, c)
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Run() = %v, want %q", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Run(): %v", err)
+			}
+			if gets != 2 {
+				t.Errorf("downloaded %d times, want 2", gets)
+			}
+			if string(b) != "content" {
+				t.Errorf("output %q, want %q", b, "content")
+			}
+		})
+	}
+}
+
+func TestCat_requireOk(t *testing.T) {
+	tests := []struct {
+		name    string
+		okAge   time.Duration
+		noOk    bool
+		minAge  time.Duration
+		wantErr string
+	}{
+		{name: "ok"},
+		{name: "missing ok", noOk: true, wantErr: "not yet complete"},
+		{name: "fresh ok", okAge: time.Minute, minAge: time.Hour},
+		{
+			name:    "stale ok",
+			okAge:   2 * time.Hour,
+			minAge:  time.Hour,
+			wantErr: "stale dump",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+			if !tt.noOk {
+				obj := fake.Put("bucket", "foo"+okExt, nil)
+				obj.Modified = obj.Modified.Add(-tt.okAge)
+			}
+
+			b, err := runCatErr(t, NewCat(fake.Client(), "bucket").
+				WithRequireOk(true, tt.minAge))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Run(): %v", err)
+			case tt.wantErr == "" && string(b) != "content":
+				t.Errorf("output %q, want %q", b, "content")
+			case tt.wantErr != "" && (err == nil ||
+				!strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Run() = %v, want %q in it", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCat_allowEmpty(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   bool
+		wantErr bool
+	}{
+		{name: "fail", wantErr: true},
+		{name: "allow", allow: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+sqlExt, nil)
+
+			_, err := runCatErr(t, NewCat(fake.Client(), "bucket").
+				WithAllowEmpty(tt.allow))
+			if tt.wantErr && (err == nil ||
+				!strings.Contains(err.Error(), "--allow-empty")) {
+				t.Errorf("Run() = %v, want empty object error", err)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("Run(): %v", err)
+			}
+		})
+	}
+}
+
+// interruptFirstGet makes fake to send only half of the object on the first
+// GET and drop the connection. It returns headers of all GET requests.
+func interruptFirstGet(t *testing.T, fake *fakeS3, body []byte,
+) func() []http.Header {
+	var mu sync.Mutex
+	var gets []http.Header
+	fake.Handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodGet {
+			return false
+		}
+		mu.Lock()
+		gets = append(gets, r.Header.Clone())
+		first := len(gets) == 1
+		mu.Unlock()
+		if !first {
+			return false
+		}
+
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return true
+		}
+		defer conn.Close()
+		fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n"+
+			"ETag: %s\r\n\r\n", len(body), (&fakeObject{Body: body}).ETag())
+		_, _ = buf.Write(body[:len(body)/2])
+		_ = buf.Flush()
+		return true
+	}
+
+	return func() []http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(gets)
+	}
+}
+
+func TestCat_resume(t *testing.T) {
+	body := []byte(strings.Repeat("0123456789", 100))
+	tests := []struct {
+		name    string
+		retries int
+		wantErr bool
+	}{
+		{name: "resumed", retries: 1},
+		{name: "no retries", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			obj := fake.Put("bucket", "foo"+sqlExt, body)
+			gets := interruptFirstGet(t, fake, body)
+
+			b, err := runCatErr(t, NewCat(fake.Client(), "bucket").
+				WithRetries(tt.retries, 0))
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Run() = nil, want error")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Run(): %v", err)
+			} else if !bytes.Equal(b, body) {
+				t.Errorf("output %d bytes, want %d", len(b), len(body))
+			}
+
+			headers := gets()
+			if len(headers) != 2 {
+				t.Fatalf("%d GET requests, want 2", len(headers))
+			}
+			wantRange := fmt.Sprintf("bytes=%d-", len(body)/2)
+			if got := headers[1].Get("Range"); got != wantRange {
+				t.Errorf("resumed with Range %q, want %q", got, wantRange)
+			} else if got := headers[1].Get("If-Match"); got != obj.ETag() {
+				t.Errorf("resumed with If-Match %q, want %q", got, obj.ETag())
+			}
+		})
+	}
+}
+
+func TestCat_printOutputChecksum(t *testing.T) {
+	sha := sha256.Sum256([]byte("content"))
+	md := md5.Sum([]byte("content"))
+	tests := []struct {
+		alg     string
+		want    string
+		wantErr bool
+	}{
+		{alg: hashSHA256, want: hex.EncodeToString(sha[:])},
+		{alg: hashMD5, want: hex.EncodeToString(md[:])},
+		{alg: "crc32", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+
+			c := NewCat(fake.Client(), "bucket")
+			if err := c.WithOutputChecksum(tt.alg); tt.wantErr {
+				if err == nil {
+					t.Error("WithOutputChecksum() = nil, want error")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("WithOutputChecksum(): %v", err)
+			}
+
+			stderr := captureStderr(t, func() { runCat(t, c) })
+			want := tt.alg + ": " + tt.want + "  foo" + sqlExt + "\n"
+			if stderr != want {
+				t.Errorf("stderr %q, want %q", stderr, want)
+			}
+		})
+	}
+}
+
+func TestCat_contentType(t *testing.T) {
+	tests := []struct {
+		name    string
+		have    string
+		want    string
+		force   bool
+		wantErr bool
+	}{
+		{name: "not checked", have: "text/html"},
+		{
+			name: "match",
+			have: "application/octet-stream",
+			want: "application/octet-stream",
+		},
+		{
+			name: "parameters ignored",
+			have: "text/plain; charset=utf-8",
+			want: "text/plain",
+		},
+		{
+			name:    "mismatch",
+			have:    "text/html",
+			want:    "application/octet-stream",
+			wantErr: true,
+		},
+		{
+			name:  "forced",
+			have:  "text/html",
+			want:  "application/octet-stream",
+			force: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.store("bucket", "foo"+sqlExt, &fakeObject{
+				Body:        []byte("content"),
+				ContentType: tt.have,
+			})
+
+			_, err := runCatErr(t, NewCat(fake.Client(), "bucket").
+				WithContentType(tt.want).WithForce(tt.force))
+			if tt.wantErr && (err == nil ||
+				!strings.Contains(err.Error(), "Content-Type")) {
+				t.Errorf("Run() = %v, want Content-Type error", err)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("Run(): %v", err)
+			}
+		})
+	}
+}
+
+func TestCat_partialOk(t *testing.T) {
+	body := []byte(strings.Repeat("0123456789", 100))
+	tests := []struct {
+		name     string
+		partial  bool
+		wantCode int
+	}{
+		{name: "partial ok", partial: true, wantCode: exitPartial},
+		{name: "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+sqlExt, body)
+			interruptFirstGet(t, fake, body)
+
+			b, err := runCatErr(t, NewCat(fake.Client(), "bucket").
+				WithPartialOk(tt.partial))
+			if err == nil {
+				t.Fatal("Run() = nil, want error")
+			}
+
+			var exitErr *exitError
+			if !errors.As(err, &exitErr) {
+				if tt.wantCode != 0 {
+					t.Errorf("Run() = %v, want exit code %d", err, tt.wantCode)
+				}
+			} else if exitErr.code != tt.wantCode {
+				t.Errorf("exit code %d, want %d", exitErr.code, tt.wantCode)
+			}
+
+			// Everything downloaded is written anyway.
+			if !bytes.Equal(b, body[:len(body)/2]) {
+				t.Errorf("output %d bytes, want the first %d", len(b),
+					len(body)/2)
+			}
+		})
+	}
+}
+
+func TestCat_outputNull(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt bool
+		wantErr bool
+	}{
+		{name: "discarded"},
+		{name: "checked anyway", corrupt: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+			if tt.corrupt {
+				corruptChecksum(fake)
+			}
+
+			stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stdout.Close()
+
+			oldOutput := log.Writer()
+			var logBuf bytes.Buffer
+			log.SetOutput(&logBuf)
+			t.Cleanup(func() { log.SetOutput(oldOutput) })
+
+			c := NewCat(fake.Client(), "bucket").WithOutputNull(true).
+				WithStdout(stdout)
+			err = c.Run(context.Background(), "foo")
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Run() = nil, want error")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Run(): %v", err)
+			}
+
+			if fi, err := stdout.Stat(); err != nil {
+				t.Fatal(err)
+			} else if fi.Size() != 0 {
+				t.Errorf("%d bytes written to stdout", fi.Size())
+			}
+			if c.Written() != int64(len("content")) {
+				t.Errorf("written %d, want %d", c.Written(), len("content"))
+			}
+			if !regexp.MustCompile(`discarded 7 B in \S+: \S+ \S+/s`).
+				MatchString(logBuf.String()) {
+				t.Errorf("no rate in log %q", logBuf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// WithManifest configures Cat to output concatenation of all parts, listed in
+// manifest key, instead of name.bz2.crypt. If verify is true, every part is
+// checked against its size and checksum from the manifest, while it's
+// streamed. It stops on the first mismatch, unless continueOnError is true.
+func (self *Cat) WithManifest(key string, verify, continueOnError bool) *Cat {
+	self.manifest = key
+	self.verifyParts = verify
+	self.continueOnError = continueOnError
+	return self
+}
+
+func (self *Cat) runManifest(ctx context.Context) error {
+	entries, err := readManifest(ctx, self.client, self.bucket, self.manifest)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for i := range entries {
+		total += entries[i].Size
+	}
+	self.extendTimeout(total)
+
+	var errs []error
+	err = self.writeTo(func(w io.Writer) error {
+		if self.outHash != nil {
+			w = io.MultiWriter(w, self.outHash)
+		}
+		for i := range entries {
+			entry := &entries[i]
+			err := self.catPart(ctx, entry, w)
+			if err == nil {
+				continue
+			}
+
+			var mismatch *partMismatchError
+			if !self.continueOnError || !errors.As(err, &mismatch) {
+				return err
+			}
+			log.Printf("✗ %s: %v", entry.Key, err)
+			errs = append(errs, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	} else if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	self.verified = self.verifyParts
+	return self.printOutputChecksum(self.manifest)
+}
+
+// catPart writes part of manifest into w and checks it, if configured.
+func (self *Cat) catPart(ctx context.Context, entry *manifestEntry,
+	w io.Writer,
+) error {
+	log.Println("download", entry.Key)
+	resp, err := self.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(self.bucket),
+		Key:    aws.String(entry.Key),
+	}, self.getOptions()...)
+	if err != nil {
+		return fmt.Errorf("read %q: %w", entry.Key, err)
+	}
+	defer resp.Body.Close()
+
+	h := sha256.New()
+	if self.verifyParts {
+		w = io.MultiWriter(w, h)
+	}
+
+	out := outputWriter{w: w}
+	n, err := io.Copy(&out, resp.Body)
+	self.written.Add(n)
+	if err != nil {
+		return fmt.Errorf("download %q: %w", entry.Key, err)
+	}
+
+	if self.verifyParts {
+		if err := entry.Check(n, h.Sum(nil)); err != nil {
+			return &partMismatchError{err: err}
+		}
+		log.Printf("✓ %s", entry.Key)
+	}
+	return nil
+}
+
+// partMismatchError is size or checksum mismatch of manifest part.
+type partMismatchError struct {
+	err error
+}
+
+func (self *partMismatchError) Error() string { return self.err.Error() }
+
+func (self *partMismatchError) Unwrap() error { return self.err }
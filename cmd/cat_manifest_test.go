@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// putManifest puts parts of db/foo and db/foo.sha256sums manifest with their
+// checksums, except the part of index bad, which gets a wrong checksum.
+func putManifest(fake *fakeS3, bad int, parts ...string) string {
+	var manifest strings.Builder
+	for i, part := range parts {
+		fname := "foo.part" + string(rune('1'+i))
+		fake.Put("bucket", "db/"+fname, []byte(part))
+		sum := sha256.Sum256([]byte(part))
+		if i == bad {
+			sum = sha256.Sum256([]byte("something else"))
+		}
+		manifest.WriteString(hex.EncodeToString(sum[:]) + "  " + fname + "\n")
+	}
+	key := "db/foo" + manifestExt
+	fake.Put("bucket", key, []byte(manifest.String()))
+	return key
+}
+
+func TestCat_runManifest_continueOnError(t *testing.T) {
+	fake := newFakeS3(t)
+	manifest := putManifest(fake, 1, "first,", "second,", "third")
+
+	c := NewCat(fake.Client(), "bucket").WithManifest(manifest, true, true)
+	output, err := runCatErr(t, c)
+
+	var mismatch *partMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Run() = %v, want partMismatchError", err)
+	} else if !strings.Contains(err.Error(), "db/foo.part2") {
+		t.Errorf("Run() = %v, want mismatch of db/foo.part2", err)
+	} else if strings.Contains(err.Error(), "part1") ||
+		strings.Contains(err.Error(), "part3") {
+		t.Errorf("Run() = %v, want only db/foo.part2 reported", err)
+	}
+
+	if got := string(output); got != "first,second,third" {
+		t.Errorf("output = %q, want all parts after the mismatch", got)
+	}
+}
+
+func TestCat_runManifest_stopOnError(t *testing.T) {
+	tests := []struct {
+		name  string
+		bad   int
+		want  string
+		other string
+	}{
+		{name: "first", bad: 0, want: "db/foo.part1", other: "part2"},
+		{name: "second", bad: 1, want: "db/foo.part2", other: "part1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			manifest := putManifest(fake, tt.bad, "first,", "second")
+
+			c := NewCat(fake.Client(), "bucket").WithManifest(manifest, true,
+				false)
+			_, err := runCatErr(t, c)
+
+			var mismatch *partMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("Run() = %v, want partMismatchError", err)
+			} else if msg := err.Error(); !strings.Contains(msg, tt.want) ||
+				strings.Contains(msg, tt.other) {
+				t.Errorf("Run() = %v, want only %s reported", err, tt.want)
+			}
+		})
+	}
+}
+
+// runCatErr runs c for "foo" and returns its output, which is kept even if
+// c failed, and the error.
+func runCatErr(t *testing.T, c *Cat) ([]byte, error) {
+	t.Helper()
+	output := filepath.Join(t.TempDir(), "foo.sql")
+	err := c.WithOutput(output, false).Run(context.Background(), "foo")
+	b, readErr := os.ReadFile(output)
+	if readErr != nil && !errors.Is(readErr, os.ErrNotExist) {
+		t.Fatal(readErr)
+	}
+	return b, err
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/dsh2dsh/expx-dbcopy/internal/retry"
+)
+
+// WithPartConcurrency configures Cat to download n parts of multipart object
+// concurrently and write them in order, buffering out of order parts up to
+// maxBuffer bytes. Parts being downloaded are limited by the same maxBuffer,
+// so memory is up to twice of it. Every part is validated by its own checksum,
+// if it has one.
+func (self *Cat) WithPartConcurrency(n int, maxBuffer int64) *Cat {
+	self.partConcurrency = max(n, 1)
+	self.reorderBuffer = maxBuffer
+	return self
+}
+
+// downloadParts downloads parts of multipart key concurrently and writes them
+// into w in order. It downloads key by single request, if it isn't multipart.
+// Every part uses If-Match with ETag of the object, so it fails if the object
+// was replaced meanwhile.
+func (self *Cat) downloadParts(ctx context.Context, key string, w io.Writer,
+) error {
+	h, err := self.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:     aws.String(self.bucket),
+		Key:        aws.String(key),
+		PartNumber: aws.Int32(1),
+	}, self.getOptions()...)
+	if err != nil {
+		return fmt.Errorf("heading %q: %w", key, err)
+	}
+
+	parts := int(aws.ToInt32(h.PartsCount))
+	if err := self.checkContentType(key, h.ContentType); err != nil {
+		return err
+	} else if parts < 2 {
+		return self.downloadStream(ctx, key, w)
+	}
+	// All parts, except the last one, have the same size.
+	partSize := aws.ToInt64(h.ContentLength)
+	self.extendTimeout(partSize * int64(parts))
+
+	var validated atomic.Int32
+	err = self.fetchOrdered(ctx, w, parts, self.partConcurrency, partSize,
+		func(ctx context.Context, seq int) ([]byte, error) {
+			b, ok, err := self.getPart(ctx, key, int32(seq+1), h.ETag)
+			if ok {
+				validated.Add(1)
+			}
+			return b, err
+		})
+	if err != nil {
+		return fmt.Errorf("download %q: %w", key, err)
+	}
+	self.verified = int(validated.Load()) == parts
+	return nil
+}
+
+// getPart reads part n of key, retrying it as a whole by configured retries.
+// It also returns true, if the part was validated by its checksum.
+func (self *Cat) getPart(ctx context.Context, key string, n int32,
+	etag *string,
+) ([]byte, bool, error) {
+	var buf bytes.Buffer
+	var validated bool
+	err := retry.Do(ctx, self.retryPolicy(key), func(ctx context.Context) error {
+		buf.Reset()
+		resp, err := self.client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket:       aws.String(self.bucket),
+			Key:          aws.String(key),
+			PartNumber:   aws.Int32(n),
+			IfMatch:      etag,
+			ChecksumMode: types.ChecksumModeEnabled,
+		}, self.getOptions()...)
+		if err != nil {
+			return permanentClientError(fmt.Errorf("read %q: %w", key, err))
+		}
+		defer resp.Body.Close()
+
+		validated = validatedChecksum(resp)
+		if resp.ContentLength != nil {
+			buf.Grow(int(*resp.ContentLength))
+		}
+		if _, err := buf.ReadFrom(resp.Body); err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("part %d: %w", n, err)
+	}
+	return buf.Bytes(), validated, nil
+}
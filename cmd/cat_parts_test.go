@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCat_downloadParts(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.PutParts("bucket", "foo"+sqlExt, []byte(strings.Repeat("a", 1000)),
+		[]byte(strings.Repeat("b", 1000)), []byte(strings.Repeat("c", 1000)),
+		[]byte(strings.Repeat("d", 1000)), []byte("tail"))
+
+	want := runCat(t, NewCat(fake.Client(), "bucket"))
+
+	tests := []struct {
+		name      string
+		maxBuffer int64
+	}{
+		{name: "buffered", maxBuffer: 1 << 20},
+		{name: "buffer smaller than part", maxBuffer: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runCat(t, NewCat(fake.Client(), "bucket").
+				WithPartConcurrency(3, tt.maxBuffer))
+			if !bytes.Equal(got, want) {
+				t.Errorf("multipart output (%d bytes) isn't single stream "+
+					"output (%d bytes)", len(got), len(want))
+			}
+			if !slices.ContainsFunc(fake.Requests(), func(s string) bool {
+				return strings.Contains(s, "partNumber=5")
+			}) {
+				t.Error("the last part isn't downloaded by its number")
+			}
+		})
+	}
+}
+
+func TestCat_fetchOrdered_concurrency(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunkSize int64
+		want      int32
+	}{
+		{name: "fit buffer", chunkSize: 25, want: 4},
+		{name: "two fit buffer", chunkSize: 50, want: 2},
+		{name: "bigger than buffer", chunkSize: 1000, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCat(nil, "").WithPartConcurrency(4, 100)
+			var active, maxActive atomic.Int32
+			release := make(chan struct{})
+			var buf bytes.Buffer
+			go func() {
+				// Let all allowed workers start, before any of them finishes.
+				for active.Load() < tt.want {
+					time.Sleep(time.Millisecond)
+				}
+				close(release)
+			}()
+
+			err := c.fetchOrdered(context.Background(), &buf, 8, 4, tt.chunkSize,
+				func(ctx context.Context, seq int) ([]byte, error) {
+					n := active.Add(1)
+					defer active.Add(-1)
+					for {
+						m := maxActive.Load()
+						if n <= m || maxActive.CompareAndSwap(m, n) {
+							break
+						}
+					}
+					<-release
+					return []byte{byte('0' + seq)}, nil
+				})
+			if err != nil {
+				t.Fatalf("fetchOrdered(): %v", err)
+			} else if got := buf.String(); got != "01234567" {
+				t.Errorf("written %q, want %q", got, "01234567")
+			}
+			if got := maxActive.Load(); got != tt.want {
+				t.Errorf("%d chunks fetched at once, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// runCat runs c for "foo" and returns its output.
+func runCat(t *testing.T, c *Cat) []byte {
+	t.Helper()
+	output := filepath.Join(t.TempDir(), "foo.sql")
+	c.WithOutput(output, false)
+	if err := c.Run(context.Background(), "foo"); err != nil {
+		t.Fatalf("Run(): %v", err)
+	}
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/dsh2dsh/expx-dbcopy/internal/reorder"
+	"github.com/dsh2dsh/expx-dbcopy/internal/retry"
+)
+
+// rangeSize is size of range, downloaded by single request with
+// --concurrency.
+const rangeSize = 8 << 20
+
+// WithConcurrency configures Cat to download n ranges of the object
+// concurrently and write them in order, buffering out of order ranges up to
+// maxBuffer bytes.
+func (self *Cat) WithConcurrency(n int, maxBuffer int64) *Cat {
+	self.concurrency = max(n, 1)
+	self.reorderBuffer = maxBuffer
+	return self
+}
+
+// downloadRanges downloads key by ranges concurrently and writes them into w
+// in order. Every range uses If-Match with ETag of the object, so it fails if
+// the object was replaced meanwhile.
+func (self *Cat) downloadRanges(ctx context.Context, key string, w io.Writer,
+) error {
+	h, err := self.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(self.bucket),
+		Key:    aws.String(key),
+	}, self.getOptions()...)
+	if err != nil {
+		return fmt.Errorf("heading %q: %w", key, err)
+	}
+
+	size := aws.ToInt64(h.ContentLength)
+	if err := self.checkContentType(key, h.ContentType); err != nil {
+		return err
+	} else if err := checkEmpty(key, size, self.allowEmpty); err != nil {
+		return err
+	} else if size <= rangeSize {
+		return self.downloadStream(ctx, key, w)
+	}
+	self.extendTimeout(size)
+
+	n := int((size + rangeSize - 1) / rangeSize)
+	err = self.fetchOrdered(ctx, w, n, self.concurrency, rangeSize,
+		func(ctx context.Context, seq int) ([]byte, error) {
+			start := int64(seq) * rangeSize
+			end := min(start+rangeSize, size) - 1
+			return self.getRange(ctx, key, start, end, h.ETag)
+		})
+	if err != nil {
+		return fmt.Errorf("download %q: %w", key, err)
+	}
+	return nil
+}
+
+// fetchOrdered calls fetch for chunks from 0 to n-1, up to concurrency of
+// them at once, and writes fetched chunks into w in order, buffering out of
+// order chunks up to configured size. Every fetching worker holds whole chunk
+// of chunkSize bytes in memory, so concurrency is reduced to workers, which
+// chunks fit into the same size. It stops on the first error.
+func (self *Cat) fetchOrdered(ctx context.Context, w io.Writer, n int,
+	concurrency int, chunkSize int64,
+	fetch func(ctx context.Context, seq int) ([]byte, error),
+) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	if chunkSize > 0 {
+		maxWorkers := int(max(self.reorderBuffer/chunkSize, 1))
+		if maxWorkers < concurrency {
+			log.Printf("concurrency reduced to %d by --reorder-buffer",
+				maxWorkers)
+			concurrency = maxWorkers
+		}
+	}
+
+	ordered := reorder.New(w, self.reorderBuffer)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for seq := 0; seq < n && ctx.Err() == nil; seq++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			b, err := fetch(ctx, seq)
+			if err == nil {
+				err = ordered.Write(ctx, seq, b)
+			}
+			if err != nil {
+				cancel(err)
+			}
+		}()
+	}
+	wg.Wait()
+	return context.Cause(ctx)
+}
+
+// getRange reads bytes from start to end of key, retrying it as a whole by
+// configured retries.
+func (self *Cat) getRange(ctx context.Context, key string, start, end int64,
+	etag *string,
+) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, end-start+1))
+	err := retry.Do(ctx, self.retryPolicy(key), func(ctx context.Context) error {
+		buf.Reset()
+		resp, err := self.client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(self.bucket),
+			Key:    aws.String(key),
+			Range: aws.String("bytes=" + strconv.FormatInt(start, 10) + "-" +
+				strconv.FormatInt(end, 10)),
+			IfMatch: etag,
+		}, self.getOptions()...)
+		if err != nil {
+			return permanentClientError(fmt.Errorf("read %q: %w", key, err))
+		}
+		defer resp.Body.Close()
+
+		if _, err := buf.ReadFrom(resp.Body); err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("range %d-%d: %w", start, end, err)
+	}
+	return buf.Bytes(), nil
+}
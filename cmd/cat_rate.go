@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errSlowDownload = errors.New("download too slow")
+	errCatTimeout   = fmt.Errorf("download timeout: %w", context.DeadlineExceeded)
+)
+
+// WithMinRate configures Cat to interrupt download, if it reads less than
+// bytesPerSec on average during window, instead of waiting for the flat
+// command timeout. If size of the response is known, download is interrupted
+// also after window plus time of reading it with bytesPerSec. Only time spent
+// waiting for the response body is measured, so slow consumer of the output
+// doesn't interrupt download. Interrupted download is resumed like any other
+// read error, if retries configured.
+func (self *Cat) WithMinRate(bytesPerSec int64, window time.Duration) *Cat {
+	self.minRate = bytesPerSec
+	self.rateWindow = window
+	return self
+}
+
+// watchRate returns r, which measures reads, and starts goroutine, which
+// cancels ctx with errSlowDownload, if throughput drops below configured
+// floor. size is length of r, or -1, if it isn't known. The goroutine exits
+// when ctx is done.
+func (self *Cat) watchRate(ctx context.Context,
+	cancel context.CancelCauseFunc, r io.Reader, size int64,
+) io.Reader {
+	if self.minRate <= 0 || self.rateWindow <= 0 {
+		return r
+	}
+
+	rr := &rateReader{r: r}
+	budget := time.Duration(-1)
+	if size >= 0 {
+		budget = self.rateWindow + time.Duration(
+			float64(size)/float64(self.minRate)*float64(time.Second))
+	}
+	go self.checkRate(ctx, cancel, rr, budget)
+	return rr
+}
+
+// checkRate periodically checks r has read not less than configured floor
+// during every window of time it was blocked in Read, and whole time blocked
+// doesn't exceed budget, if it isn't negative.
+func (self *Cat) checkRate(ctx context.Context,
+	cancel context.CancelCauseFunc, r *rateReader, budget time.Duration,
+) {
+	t := time.NewTicker(self.rateWindow / 4)
+	defer t.Stop()
+
+	var lastN int64
+	var lastD time.Duration
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		n, d := r.Stat()
+		if budget >= 0 && d > budget {
+			cancel(fmt.Errorf("%w: read for %v, expected not longer than %v",
+				errSlowDownload, d.Truncate(time.Second),
+				budget.Truncate(time.Second)))
+			return
+		} else if d-lastD < self.rateWindow {
+			continue
+		}
+
+		rate := float64(n-lastN) / (d - lastD).Seconds()
+		if rate < float64(self.minRate) {
+			v, suffix := humanizeBytes(int64(rate), true)
+			cancel(fmt.Errorf("%w: %s %s/s during last %v of reading",
+				errSlowDownload, v, suffix, (d - lastD).Truncate(time.Second)))
+			return
+		}
+		lastN, lastD = n, d
+	}
+}
+
+// rateReader counts read bytes and time spent blocked in Read.
+type rateReader struct {
+	r       io.Reader
+	n       atomic.Int64
+	blocked atomic.Int64 // nanoseconds of completed reads
+	since   atomic.Int64 // start of current read in unix nanoseconds or 0
+}
+
+func (self *rateReader) Read(p []byte) (int, error) {
+	started := time.Now()
+	self.since.Store(started.UnixNano())
+	n, err := self.r.Read(p)
+	self.n.Add(int64(n))
+	// Clear since first, so Stat never counts this read twice.
+	self.since.Store(0)
+	self.blocked.Add(int64(time.Since(started)))
+	return n, err //nolint:wrapcheck // it's a proxy
+}
+
+// Stat returns number of read bytes and time spent blocked in Read,
+// including current call.
+func (self *rateReader) Stat() (int64, time.Duration) {
+	n := self.n.Load()
+	d := time.Duration(self.blocked.Load())
+	if since := self.since.Load(); since != 0 {
+		d += time.Since(time.Unix(0, since))
+	}
+	return n, d
+}
+
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (self *countingReader) Read(p []byte) (int, error) {
+	n, err := self.r.Read(p)
+	self.n.Add(int64(n))
+	return n, err //nolint:wrapcheck // it's a proxy
+}
+
+// parseBytes parses size like 512, 64k, 1MiB or 1.5GB. Both decimal and
+// binary suffixes mean powers of 1024, like humanizeBytes with iec.
+func parseBytes(s string) (int64, error) {
+	num := strings.TrimSpace(s)
+	i := strings.IndexFunc(num, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+
+	mult := 1.0
+	if i >= 0 {
+		suffix := strings.ToLower(strings.TrimSpace(num[i:]))
+		num = num[:i]
+		suffix = strings.TrimSuffix(strings.TrimSuffix(suffix, "b"), "i")
+		switch suffix {
+		case "":
+		case "k":
+			mult = 1 << 10
+		case "m":
+			mult = 1 << 20
+		case "g":
+			mult = 1 << 30
+		case "t":
+			mult = 1 << 40
+		default:
+			return 0, fmt.Errorf("unexpected size %q", s)
+		}
+	}
+
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("unexpected size %q", s)
+	}
+	return int64(v * mult), nil
+}
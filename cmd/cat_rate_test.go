@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int64
+		wantErr bool
+	}{
+		{s: "0", want: 0},
+		{s: "512", want: 512},
+		{s: "64k", want: 64 << 10},
+		{s: "64K", want: 64 << 10},
+		{s: "1MiB", want: 1 << 20},
+		{s: "1MB", want: 1 << 20},
+		{s: "1.5GB", want: 3 << 29},
+		{s: " 2 t ", want: 2 << 40},
+		{s: "1b", want: 1},
+		{s: "", wantErr: true},
+		{s: "k", wantErr: true},
+		{s: "1x", wantErr: true},
+		{s: "1.2.3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseBytes(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseBytes(%q) = %d, want error", tt.s, got)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("parseBytes(%q): %v", tt.s, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseBytes(%q) = %d, want %d", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+// slowReader reads everything it can after delay.
+type slowReader struct {
+	delay time.Duration
+}
+
+func (self *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(self.delay)
+	return len(p), nil
+}
+
+func TestCat_watchRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       io.Reader
+		size    int64
+		pause   time.Duration
+		wantErr string
+	}{
+		{
+			name:    "below floor",
+			r:       &slowReader{delay: 10 * time.Millisecond},
+			size:    -1,
+			wantErr: "during last",
+		},
+		{
+			name:    "budget exceeded",
+			r:       &slowReader{delay: time.Millisecond},
+			size:    1,
+			wantErr: "expected not longer",
+		},
+		{
+			name: "above floor",
+			r:    &slowReader{delay: time.Millisecond},
+			size: -1,
+		},
+		{
+			name:  "slow consumer",
+			r:     strings.NewReader(strings.Repeat("x", 1<<20)),
+			size:  -1,
+			pause: 10 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// slowReader with 1ms delay reads 64KiB/s.
+			c := NewCat(nil, "").WithMinRate(10<<10, 50*time.Millisecond)
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+
+			r := c.watchRate(ctx, cancel, tt.r, tt.size)
+			buf := make([]byte, 64)
+			stop := time.After(300 * time.Millisecond)
+			for ctx.Err() == nil {
+				select {
+				case <-stop:
+					cancel(nil)
+					continue
+				default:
+				}
+				if _, err := r.Read(buf); err != nil {
+					t.Fatalf("read: %v", err)
+				}
+				time.Sleep(tt.pause)
+			}
+
+			err := context.Cause(ctx)
+			if tt.wantErr == "" {
+				if errors.Is(err, errSlowDownload) {
+					t.Errorf("unexpected cause %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, errSlowDownload) {
+				t.Errorf("cause = %v, want %v", err, errSlowDownload)
+			} else if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("cause = %v, want %q in it", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+var errNotRewindable = errors.New("output can't be rewound")
+
+// WithRetryChecksum configures Cat to download the whole object again, if its
+// checksum doesn't match, because it's likely corrupted in transit, not in
+// the storage. It needs output, which can be rewound, like a file.
+func (self *Cat) WithRetryChecksum(v bool) *Cat {
+	self.retryChecksum = v
+	return self
+}
+
+// rewinder is an output, which can start over from the beginning.
+type rewinder interface {
+	Rewind() error
+}
+
+// rewind starts w over from the beginning, if it's rewinder, or returns
+// errNotRewindable.
+func rewind(w io.Writer) error {
+	if r, ok := w.(rewinder); ok {
+		return r.Rewind()
+	}
+	return errNotRewindable
+}
+
+// hashWriter writes into w and h.
+type hashWriter struct {
+	w io.Writer
+	h hash.Hash
+}
+
+func (self *hashWriter) Write(p []byte) (int, error) {
+	n, err := self.w.Write(p)
+	self.h.Write(p[:n])
+	return n, err //nolint:wrapcheck // it's a proxy
+}
+
+func (self *hashWriter) Rewind() error {
+	self.h.Reset()
+	return rewind(self.w)
+}
+
+// fileWriter writes into f and rewinds by truncating it.
+type fileWriter struct {
+	f *os.File
+}
+
+func (self *fileWriter) Write(p []byte) (int, error) {
+	return self.f.Write(p) //nolint:wrapcheck // it's a proxy
+}
+
+func (self *fileWriter) Rewind() error {
+	if err := self.f.Truncate(0); err != nil {
+		return fmt.Errorf("truncate %q: %w", self.f.Name(), err)
+	} else if _, err := self.f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek %q: %w", self.f.Name(), err)
+	}
+	return nil
+}
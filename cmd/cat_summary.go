@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	resultPartial   = "partial"
+	resultUnchanged = "unchanged"
+)
+
+// CatSummary is the outcome of Cat, printed by --summary-json. Verified is
+// true, if the whole output was checked by checksums of the object, its parts
+// or manifest.
+type CatSummary struct {
+	Result   string  `json:"result"`
+	Error    string  `json:"error,omitempty"`
+	Bucket   string  `json:"bucket"`
+	Key      string  `json:"key"`
+	Bytes    int64   `json:"bytes"`
+	Duration float64 `json:"duration_seconds"`
+	Rate     float64 `json:"bytes_per_second"`
+	Verified bool    `json:"verified"`
+}
+
+// Summary returns the outcome of Cat, which started at started and finished
+// with err.
+func (self *Cat) Summary(name string, started time.Time, err error,
+) CatSummary {
+	key := name + sqlExt
+	if self.manifest != "" {
+		key = self.manifest
+	}
+
+	d := time.Since(started)
+	summary := CatSummary{
+		Result:   resultOk,
+		Bucket:   self.bucket,
+		Key:      key,
+		Bytes:    self.written.Load(),
+		Duration: d.Seconds(),
+		Rate:     float64(self.written.Load()) / max(d.Seconds(), 0.001),
+		Verified: err == nil && self.verified,
+	}
+
+	if err != nil {
+		summary.Result, summary.Error = resultError, err.Error()
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			switch exitErr.code {
+			case exitPartial:
+				summary.Result = resultPartial
+			case exitUnchanged:
+				summary.Result = resultUnchanged
+			}
+		}
+	}
+	return summary
+}
+
+// WriteSummary writes summary of Cat as single JSON line into w.
+func (self *Cat) WriteSummary(w io.Writer, name string, started time.Time,
+	err error,
+) error {
+	summary := self.Summary(name, started, err)
+	if err := json.NewEncoder(w).Encode(&summary); err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+	return nil
+}
+
+// validatedChecksum returns true, if the SDK validates content of resp by its
+// checksum. It doesn't validate composite checksums of multipart objects,
+// like "abc=-3".
+func validatedChecksum(resp *s3.GetObjectOutput) bool {
+	for _, s := range [...]*string{
+		resp.ChecksumCRC32, resp.ChecksumCRC32C, resp.ChecksumSHA1,
+		resp.ChecksumSHA256,
+	} {
+		if s != nil && *s != "" && !strings.Contains(*s, "-") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const wireGzip = "gzip"
+
+// WithWireDecode configures Cat to accept gzip encoded response and decode it,
+// for gateways, which compress responses on the wire. Content-Encoding of the
+// stored object, if any, is kept as is, because it's a part of the content.
+func (self *Cat) WithWireDecode(v bool) *Cat {
+	self.wireDecode = v
+	return self
+}
+
+// storedEncoding returns Content-Encoding of the stored key. HeadObject has no
+// body, so nobody encodes it on the wire.
+func (self *Cat) storedEncoding(ctx context.Context, key string,
+) (string, error) {
+	h, err := self.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(self.bucket),
+		Key:    aws.String(key),
+	}, self.getOptions()...)
+	if err != nil {
+		return "", fmt.Errorf("heading %q: %w", key, err)
+	}
+	return aws.ToString(h.ContentEncoding), nil
+}
+
+// wireDecoder returns r, which decodes body, if it's gzip encoded on the wire:
+// Content-Encoding of the response is gzip on top of stored encoding.
+func wireDecoder(respEncoding, stored string, body io.Reader,
+) (io.Reader, error) {
+	wire := strings.TrimSpace(respEncoding)
+	if stored != "" {
+		wire, _ = strings.CutPrefix(wire, stored)
+		wire = strings.TrimSpace(strings.TrimPrefix(wire, ","))
+	}
+
+	switch wire {
+	case "":
+		return body, nil
+	case wireGzip:
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("decode gzip on the wire: %w", err)
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("unexpected wire encoding %q, stored encoding %q",
+		respEncoding, stored)
+}
+
+// acceptGzip replaces Accept-Encoding: identity, which the SDK sets for
+// GetObject, by Accept-Encoding: gzip.
+func acceptGzip(stack *middleware.Stack) error {
+	if _, err := stack.Finalize.Remove("DisableAcceptEncodingGzip"); err != nil {
+		return fmt.Errorf("remove accept-encoding middleware: %w", err)
+	}
+
+	err := stack.Finalize.Add(middleware.FinalizeMiddlewareFunc(
+		"AcceptEncodingWireGzip",
+		func(ctx context.Context, in middleware.FinalizeInput,
+			next middleware.FinalizeHandler,
+		) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			if req, ok := in.Request.(*smithyhttp.Request); ok {
+				req.Header.Set("Accept-Encoding", wireGzip)
+			}
+			return next.HandleFinalize(ctx, in)
+		}), middleware.Before)
+	if err != nil {
+		return fmt.Errorf("add accept-encoding middleware: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWireDecoder(t *testing.T) {
+	const content = "SELECT 1;\n"
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	if _, err := zw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	} else if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+		stored   string
+		body     []byte
+		want     string
+		wantErr  bool
+	}{
+		{name: "identity", body: []byte(content), want: content},
+		{
+			name:     "gzip",
+			encoding: "gzip",
+			body:     gzipped.Bytes(),
+			want:     content,
+		},
+		{
+			name:     "stored only",
+			encoding: "bzip2",
+			stored:   "bzip2",
+			body:     []byte(content),
+			want:     content,
+		},
+		{
+			name:     "gzip on top of stored",
+			encoding: "bzip2, gzip",
+			stored:   "bzip2",
+			body:     gzipped.Bytes(),
+			want:     content,
+		},
+		{
+			name:     "unexpected encoding",
+			encoding: "br",
+			body:     []byte(content),
+			wantErr:  true,
+		},
+		{
+			name:     "not gzip",
+			encoding: "gzip",
+			body:     []byte(content),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := wireDecoder(tt.encoding, tt.stored,
+				bytes.NewReader(tt.body))
+			if tt.wantErr {
+				if err == nil {
+					t.Error("wireDecoder() = nil, want error")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("wireDecoder(): %v", err)
+			}
+
+			var got strings.Builder
+			if _, err := io.Copy(&got, r); err != nil {
+				t.Fatalf("read: %v", err)
+			} else if got.String() != tt.want {
+				t.Errorf("decoded %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
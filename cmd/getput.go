@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/spf13/cobra"
+)
+
+const (
+	getPutTimeout = time.Hour
+	// putPartSize is default size of parts of multipart upload. The uploader
+	// buffers a few parts of input of unknown size, but S3 allows up to 10000
+	// parts, so it's max size of such input: 64MiB parts allow 625GiB.
+	putPartSize = "64MiB"
+)
+
+var (
+	getCmd = cobra.Command{
+		Use:   "get -b my-bucket key [file]",
+		Short: "Output object with exact key to stdout or file",
+		Long: `Output object with exact key to stdout or file.
+
+Unlike cat, it doesn't add any extension or --prefix to key.`,
+		Args:                  cobra.RangeArgs(1, 2),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := rootSetup(); err != nil {
+				return err
+			}
+
+			ctx, cancel := commandContext(getPutTimeout)
+			defer cancel()
+
+			if len(args) == 1 {
+				return GetObject(ctx, s3Client, s3Bucket, args[0], os.Stdout)
+			}
+
+			f, err := os.Create(args[1])
+			if err != nil {
+				return fmt.Errorf("create output: %w", err)
+			}
+			defer f.Close()
+
+			if err := GetObject(ctx, s3Client, s3Bucket, args[0], f); err != nil {
+				return err
+			} else if err := f.Close(); err != nil {
+				return fmt.Errorf("close %q: %w", args[1], err)
+			}
+			return nil
+		},
+	}
+
+	putCmd = cobra.Command{
+		Use:   "put -b my-bucket [--stream] [--part-size size] [--object-lock-mode mode --retain-until time] key [file]",
+		Short: "Upload stdin or file as object with exact key",
+		Long: `Upload stdin or file as object with exact key.
+
+Unlike markers, it doesn't add any extension or --prefix to key.
+
+With --stream, stdin of unknown size is uploaded as key and name.ok is written
+with its size after that, where name is key without .bz2.crypt, so cat and
+wait see it as any other dump:
+
+  pg_dump | dbcopy put --stream backups/foo.bz2.crypt`,
+		Args:                  cobra.RangeArgs(1, 2),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := rootSetup(); err != nil {
+				return err
+			}
+
+			ctx, cancel := commandContext(getPutTimeout)
+			defer cancel()
+
+			partSize, err := parseBytes(putPartSizeStr)
+			if err != nil {
+				return fmt.Errorf("parse --part-size: %w", err)
+			} else if partSize < manager.MinUploadPartSize {
+				return fmt.Errorf("--part-size must be at least %v bytes",
+					manager.MinUploadPartSize)
+			}
+
+			lock, err := objectLock(ctx, s3Client, s3Bucket, putLockMode,
+				putRetainUntil)
+			if err != nil {
+				return err
+			}
+
+			p := NewPut(s3Client, s3Bucket).WithPartSize(partSize).
+				WithInputOptions(lock)
+			if putStream {
+				if len(args) > 1 {
+					return errors.New("--stream reads stdin only")
+				}
+				return p.Stream(ctx, args[0], os.Stdin)
+			} else if len(args) == 1 {
+				return p.Object(ctx, args[0], os.Stdin)
+			}
+
+			f, err := os.Open(args[1])
+			if err != nil {
+				return fmt.Errorf("open input: %w", err)
+			}
+			defer f.Close()
+			return p.Object(ctx, args[0], f)
+		},
+	}
+
+	putStream      bool
+	putPartSizeStr string
+	putLockMode    string
+	putRetainUntil string
+)
+
+func init() {
+	putCmd.Flags().BoolVar(&putStream, "stream", false,
+		"upload stdin as key and write name.ok with its size")
+	putCmd.Flags().StringVar(&putPartSizeStr, "part-size", putPartSize,
+		"size of parts of multipart upload, limits max size of stdin to 10000 parts")
+	putCmd.Flags().StringVar(&putLockMode, "object-lock-mode", "",
+		"lock uploaded object in GOVERNANCE or COMPLIANCE mode")
+	putCmd.Flags().StringVar(&putRetainUntil, "retain-until", "",
+		"keep locked object until this RFC3339 time")
+	putCmd.MarkFlagsRequiredTogether("object-lock-mode", "retain-until")
+}
+
+// GetObject writes content of key into w.
+func GetObject(ctx context.Context, client *s3.Client, bucket, key string,
+	w io.Writer,
+) error {
+	log.Println("get", key)
+	resp, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("read %q: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("copy %q: %w", key, err)
+	}
+	return nil
+}
+
+// objectLock returns option of PutObject, which locks uploaded object in
+// mode until retainUntil, or nil, if mode is empty. It returns an error, if
+// object lock isn't enabled for bucket.
+func objectLock(ctx context.Context, client *s3.Client, bucket, mode,
+	retainUntil string,
+) (func(*s3.PutObjectInput), error) {
+	if mode == "" {
+		return nil, nil
+	}
+
+	lockMode := types.ObjectLockMode(mode)
+	switch lockMode {
+	case types.ObjectLockModeGovernance, types.ObjectLockModeCompliance:
+	default:
+		return nil, fmt.Errorf(
+			"unexpected --object-lock-mode=%q, expected %q or %q", mode,
+			types.ObjectLockModeGovernance, types.ObjectLockModeCompliance)
+	}
+
+	until, err := time.Parse(time.RFC3339, retainUntil)
+	if err != nil {
+		return nil, fmt.Errorf("parse --retain-until: %w", err)
+	} else if time.Until(until) <= 0 {
+		return nil, fmt.Errorf("--retain-until %v already passed", retainUntil)
+	}
+
+	resp, err := client.GetObjectLockConfiguration(ctx,
+		&s3.GetObjectLockConfigurationInput{Bucket: aws.String(bucket)})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) &&
+		apiErr.ErrorCode() == "ObjectLockConfigurationNotFoundError" {
+		return nil, fmt.Errorf("object lock isn't enabled for bucket %q", bucket)
+	} else if err != nil {
+		return nil, fmt.Errorf("object lock configuration of %q: %w", bucket,
+			err)
+	} else if resp.ObjectLockConfiguration == nil ||
+		resp.ObjectLockConfiguration.ObjectLockEnabled !=
+			types.ObjectLockEnabledEnabled {
+		return nil, fmt.Errorf("object lock isn't enabled for bucket %q", bucket)
+	}
+
+	return func(in *s3.PutObjectInput) {
+		in.ObjectLockMode = lockMode
+		in.ObjectLockRetainUntilDate = aws.Time(until)
+		// Locked objects require checksum of content.
+		in.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+	}, nil
+}
+
+func NewPut(client *s3.Client, bucket string) *Put {
+	return &Put{client: client, bucket: bucket}
+}
+
+// Put uploads objects with exact keys.
+type Put struct {
+	client *s3.Client
+	bucket string
+
+	partSize int64
+	optFns   []func(*s3.PutObjectInput)
+}
+
+// WithPartSize configures Put to upload by parts of size n. Input of unknown
+// size can't be bigger than 10000 parts.
+func (self *Put) WithPartSize(n int64) *Put {
+	self.partSize = n
+	return self
+}
+
+// WithInputOptions configures Put to modify every PutObjectInput by not nil
+// optFns.
+func (self *Put) WithInputOptions(optFns ...func(*s3.PutObjectInput)) *Put {
+	for _, fn := range optFns {
+		if fn != nil {
+			self.optFns = append(self.optFns, fn)
+		}
+	}
+	return self
+}
+
+// Object uploads content of r as key. It uses multipart upload, if r is big
+// enough, so size of r doesn't have to be known.
+func (self *Put) Object(ctx context.Context, key string, r io.Reader) error {
+	log.Println("put", key)
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(self.bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	}
+	for _, fn := range self.optFns {
+		fn(input)
+	}
+
+	uploader := manager.NewUploader(self.client, func(u *manager.Uploader) {
+		if self.partSize > 0 {
+			u.PartSize = self.partSize
+		}
+	})
+	if _, err := uploader.Upload(ctx, input); err != nil {
+		return fmt.Errorf("upload %q: %w", key, err)
+	}
+	return nil
+}
+
+// Stream uploads content of r of unknown size as key, using multipart
+// upload, and writes name.ok with its size after that, where name is key
+// without .bz2.crypt.
+func (self *Put) Stream(ctx context.Context, key string, r io.Reader) error {
+	cr := &countingReader{r: r}
+	if err := self.Object(ctx, key, cr); err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(key, sqlExt)
+	return NewMarkers(self.client, self.bucket).Ok(ctx, name, cr.n.Load())
+}
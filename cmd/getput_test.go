@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+)
+
+func TestPut_Object_GetObject(t *testing.T) {
+	fake := newFakeS3(t)
+	client := fake.Client()
+	ctx := context.Background()
+
+	// Keys are exact, without --prefix and extensions.
+	oldPrefix := s3Prefix
+	s3Prefix = "dumps/"
+	t.Cleanup(func() { s3Prefix = oldPrefix })
+
+	err := NewPut(client, "bucket").Object(ctx, "some/key.txt",
+		bytes.NewReader([]byte("content")))
+	if err != nil {
+		t.Fatalf("Object(): %v", err)
+	} else if _, ok := fake.Get("bucket", "some/key.txt"); !ok {
+		t.Fatal("object isn't uploaded with exact key")
+	}
+
+	var buf bytes.Buffer
+	err = GetObject(ctx, client, "bucket", "some/key.txt", &buf)
+	if err != nil {
+		t.Fatalf("GetObject(): %v", err)
+	} else if buf.String() != "content" {
+		t.Errorf("got %q, want %q", buf.String(), "content")
+	}
+
+	if err := GetObject(ctx, client, "bucket", "missing", &buf); err == nil {
+		t.Error("GetObject(missing) = nil, want error")
+	}
+}
+
+func TestPut_Stream(t *testing.T) {
+	fake := newFakeS3(t)
+	body := bytes.Repeat([]byte("0123456789abcdef"),
+		int(manager.MinUploadPartSize+1024)/16)
+
+	// io.MultiReader hides the length from the uploader, like stdin does.
+	r := io.MultiReader(bytes.NewReader(body))
+	err := NewPut(fake.Client(), "bucket").
+		WithPartSize(manager.MinUploadPartSize).
+		Stream(context.Background(), "dumps/foo"+sqlExt, r)
+	if err != nil {
+		t.Fatalf("Stream(): %v", err)
+	}
+
+	obj, ok := fake.Get("bucket", "dumps/foo"+sqlExt)
+	if !ok {
+		t.Fatal("object isn't uploaded with exact key")
+	} else if !bytes.Equal(obj.Body, body) {
+		t.Errorf("uploaded %d bytes, want %d", len(obj.Body), len(body))
+	} else if len(obj.PartSizes) != 2 {
+		t.Errorf("uploaded by %d parts, want 2", len(obj.PartSizes))
+	}
+
+	okObj, ok := fake.Get("bucket", "dumps/foo"+okExt)
+	if !ok {
+		t.Fatal("no .ok written")
+	}
+	if want := strconv.Itoa(len(body)); string(okObj.Body) != want {
+		t.Errorf(".ok = %q, want %q", okObj.Body, want)
+	}
+}
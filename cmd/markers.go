@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/cobra"
+)
+
+const markersTimeout = 5 * time.Minute
+
+var (
+	markersCmd = cobra.Command{
+		Use:   "markers",
+		Short: "Write status markers of name, like producers do",
+	}
+
+	markersStartedCmd = cobra.Command{
+		Use:                   "started -b my-bucket name",
+		Short:                 "Write name.started",
+		Args:                  cobra.ExactArgs(1),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMarkers(func(ctx context.Context, m *Markers) error {
+				return m.Started(ctx, objectName(args[0]))
+			})
+		},
+	}
+
+	markersOkCmd = cobra.Command{
+		Use:   "ok -b my-bucket name [size]",
+		Short: "Write name.ok with size of name.bz2.crypt",
+		Long: `Write name.ok with size of name.bz2.crypt.
+
+If size isn't given, it's from name.bz2.crypt itself.`,
+		Args:                  cobra.RangeArgs(1, 2),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			size := int64(-1)
+			if len(args) > 1 {
+				n, err := strconv.ParseInt(args[1], 10, 64)
+				if err != nil || n < 0 {
+					return fmt.Errorf("unexpected size %q", args[1])
+				}
+				size = n
+			}
+			return runMarkers(func(ctx context.Context, m *Markers) error {
+				return m.Ok(ctx, objectName(args[0]), size)
+			})
+		},
+	}
+
+	markersErrorCmd = cobra.Command{
+		Use:   "error -b my-bucket name [message]",
+		Short: "Write name.error with error message",
+		Long: `Write name.error with error message.
+
+If message isn't given, it's read from stdin.`,
+		Args:                  cobra.RangeArgs(1, 2),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var msg string
+			if len(args) > 1 {
+				msg = args[1]
+			} else if b, err := io.ReadAll(os.Stdin); err != nil {
+				return fmt.Errorf("read message from stdin: %w", err)
+			} else {
+				msg = string(b)
+			}
+
+			if strings.TrimSpace(msg) == "" {
+				return errors.New("empty error message")
+			}
+			return runMarkers(func(ctx context.Context, m *Markers) error {
+				return m.Error(ctx, objectName(args[0]), msg)
+			})
+		},
+	}
+)
+
+func init() {
+	markersCmd.AddCommand(&markersStartedCmd)
+	markersCmd.AddCommand(&markersOkCmd)
+	markersCmd.AddCommand(&markersErrorCmd)
+}
+
+func runMarkers(fn func(ctx context.Context, m *Markers) error) error {
+	if err := rootSetup(); err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext(markersTimeout)
+	defer cancel()
+	return fn(ctx, NewMarkers(s3Client, s3Bucket))
+}
+
+func NewMarkers(client *s3.Client, bucket string) *Markers {
+	return &Markers{client: client, bucket: bucket}
+}
+
+// Markers writes status markers, which are expected by wait.
+type Markers struct {
+	client *s3.Client
+	bucket string
+}
+
+// Started writes empty name.started.
+func (self *Markers) Started(ctx context.Context, name string) error {
+	return self.put(ctx, name+startedExt, "")
+}
+
+// Ok writes name.ok with size of the data object. If size is negative, it's
+// from the data object itself.
+func (self *Markers) Ok(ctx context.Context, name string, size int64) error {
+	if size < 0 {
+		key := name + sqlExt
+		h, err := self.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(self.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("heading %q: %w", key, err)
+		}
+		size = aws.ToInt64(h.ContentLength)
+	}
+	return self.put(ctx, name+okExt, strconv.FormatInt(size, 10))
+}
+
+// Error writes name.error with msg, which is printed by wait as remote error.
+func (self *Markers) Error(ctx context.Context, name, msg string) error {
+	return self.put(ctx, name+errorExt, msg)
+}
+
+func (self *Markers) put(ctx context.Context, key, body string) error {
+	log.Println("write", key)
+	_, err := self.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(self.bucket),
+		Key:           aws.String(key),
+		Body:          strings.NewReader(body),
+		ContentLength: aws.Int64(int64(len(body))),
+		ContentType:   aws.String("text/plain"),
+	})
+	if err != nil {
+		return fmt.Errorf("write %q: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMarkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		write    func(ctx context.Context, m *Markers) error
+		wantKey  string
+		wantBody string
+	}{
+		{
+			name: "started",
+			write: func(ctx context.Context, m *Markers) error {
+				return m.Started(ctx, "foo")
+			},
+			wantKey: "foo" + startedExt,
+		},
+		{
+			name: "ok with size",
+			write: func(ctx context.Context, m *Markers) error {
+				return m.Ok(ctx, "foo", 42)
+			},
+			wantKey:  "foo" + okExt,
+			wantBody: "42",
+		},
+		{
+			name: "ok with size of data",
+			write: func(ctx context.Context, m *Markers) error {
+				return m.Ok(ctx, "foo", -1)
+			},
+			wantKey:  "foo" + okExt,
+			wantBody: "7",
+		},
+		{
+			name: "error",
+			write: func(ctx context.Context, m *Markers) error {
+				return m.Error(ctx, "foo", "dump failed")
+			},
+			wantKey:  "foo" + errorExt,
+			wantBody: "dump failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+
+			m := NewMarkers(fake.Client(), "bucket")
+			if err := tt.write(context.Background(), m); err != nil {
+				t.Fatalf("write marker: %v", err)
+			}
+
+			obj, ok := fake.Get("bucket", tt.wantKey)
+			if !ok {
+				t.Fatalf("%q isn't written", tt.wantKey)
+			} else if string(obj.Body) != tt.wantBody {
+				t.Errorf("%q = %q, want %q", tt.wantKey, obj.Body, tt.wantBody)
+			} else if obj.ContentType != "text/plain" {
+				t.Errorf("content type %q, want text/plain", obj.ContentType)
+			}
+		})
+	}
+}
+
+func TestMarkers_Ok_missingData(t *testing.T) {
+	fake := newFakeS3(t)
+	m := NewMarkers(fake.Client(), "bucket")
+	if err := m.Ok(context.Background(), "foo", -1); err == nil {
+		t.Error("Ok() = nil, want error")
+	} else if _, ok := fake.Get("bucket", "foo"+okExt); ok {
+		t.Error("ok marker written without data object")
+	}
+}
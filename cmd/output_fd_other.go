@@ -0,0 +1,12 @@
+//go:build !unix
+
+package cmd
+
+import (
+	"errors"
+	"os"
+)
+
+func outputFd(fd int) (*os.File, error) {
+	return nil, errors.New("--output-fd isn't supported on this platform")
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// outputFd returns already open file descriptor fd as a file, after it checked
+// fd is open for writing.
+func outputFd(fd int) (*os.File, error) {
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd),
+		syscall.F_GETFL, 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("output fd %d: %w", fd, errno)
+	} else if flags&syscall.O_ACCMODE == syscall.O_RDONLY {
+		return nil, fmt.Errorf("output fd %d isn't open for writing", fd)
+	}
+	return os.NewFile(uintptr(fd), "fd "+strconv.Itoa(fd)), nil
+}
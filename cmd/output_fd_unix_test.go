@@ -0,0 +1,66 @@
+//go:build unix
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestOutputFd_pipe(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Like inherited descriptor, which isn't owned by any os.File yet.
+	fd, err := syscall.Dup(int(w.Fd()))
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := outputFd(fd)
+	if err != nil {
+		t.Fatalf("outputFd(): %v", err)
+	}
+
+	read := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		read <- b
+	}()
+
+	err = NewCat(fake.Client(), "bucket").WithStdout(f).
+		Run(context.Background(), "foo")
+	f.Close()
+	if err != nil {
+		t.Fatalf("Run(): %v", err)
+	} else if b := <-read; string(b) != "content" {
+		t.Errorf("read from pipe %q, want %q", b, "content")
+	}
+}
+
+func TestOutputFd_notWritable(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if _, err := outputFd(int(r.Fd())); err == nil {
+		t.Error("outputFd(read end) = nil, want error")
+	}
+
+	// Descriptor isn't open at all.
+	if _, err := outputFd(1 << 20); err == nil {
+		t.Error("outputFd(not open) = nil, want error")
+	}
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const redacted = "***"
+
+// errPrintedConfig is returned by rootSetup after --print-config printed
+// configuration and the command must exit successfully without running.
+var errPrintedConfig = errors.New("printed config")
+
+type effectiveConfig struct {
+	Bucket          string `json:"bucket"`
+	Prefix          string `json:"prefix"`
+	BootstrapRegion string `json:"bootstrapRegion"`
+	Region          string `json:"region,omitempty"`
+	RegionError     string `json:"regionError,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	UseAccelerate   bool   `json:"useAccelerate"`
+	LogFile         string `json:"logFile,omitempty"`
+
+	Timeouts struct {
+		Setup   string `json:"setup"`
+		Command string `json:"command"`
+	} `json:"timeouts"`
+
+	Retry struct {
+		Mode        string `json:"mode,omitempty"`
+		MaxAttempts int    `json:"maxAttempts,omitempty"`
+	} `json:"retry"`
+
+	Credentials struct {
+		Source          string `json:"source,omitempty"`
+		AccessKeyID     string `json:"accessKeyId,omitempty"`
+		SecretAccessKey string `json:"secretAccessKey,omitempty"`
+		SessionToken    string `json:"sessionToken,omitempty"`
+		Error           string `json:"error,omitempty"`
+	} `json:"credentials"`
+}
+
+// printConfig prints effective configuration of awsCfg as JSON to w, with
+// redacted secrets. Bootstrap region is the region of client, which detects
+// region of the bucket, and region is the detected one.
+func printConfig(ctx context.Context, w io.Writer, awsCfg *aws.Config,
+	client *s3.Client,
+) error {
+	cfg := effectiveConfig{
+		Bucket:          s3Bucket,
+		Prefix:          s3Prefix,
+		BootstrapRegion: awsCfg.Region,
+		Endpoint:        aws.ToString(awsCfg.BaseEndpoint),
+		UseAccelerate:   useAccelerate,
+		LogFile:         logFile,
+	}
+	cfg.Timeouts.Setup = setupTimeout.String()
+	cfg.Timeouts.Command = "default"
+	if commandTimeout > 0 {
+		cfg.Timeouts.Command = commandTimeout.String()
+	}
+	cfg.Retry.Mode = string(awsCfg.RetryMode)
+	cfg.Retry.MaxAttempts = awsCfg.RetryMaxAttempts
+
+	if awsCfg.Credentials != nil {
+		creds, err := awsCfg.Credentials.Retrieve(ctx)
+		if err != nil {
+			cfg.Credentials.Error = err.Error()
+		} else {
+			cfg.Credentials.Source = creds.Source
+			cfg.Credentials.AccessKeyID = redactKeyID(creds.AccessKeyID)
+			cfg.Credentials.SecretAccessKey = redact(creds.SecretAccessKey)
+			cfg.Credentials.SessionToken = redact(creds.SessionToken)
+		}
+	}
+
+	if region, err := bucketRegion(ctx, client, s3Bucket); err != nil {
+		cfg.RegionError = err.Error()
+	} else {
+		cfg.Region = region
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&cfg); err != nil {
+		return fmt.Errorf("encode config: %w", err)
+	}
+	return nil
+}
+
+func redact(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactKeyID keeps first 4 chars of access key id, which isn't secret by
+// itself, but enough to tell which key is used.
+func redactKeyID(s string) string {
+	if len(s) <= 4 {
+		return redact(s)
+	}
+	return s[:4] + strings.Repeat("*", len(s)-4)
+}
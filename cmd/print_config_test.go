@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+func TestPrintConfig(t *testing.T) {
+	s3 := newFakeS3(t)
+	s3.Handler = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodHead || r.URL.Path != "/bucket" {
+			return false
+		}
+		w.Header().Set("X-Amz-Bucket-Region", "eu-central-1")
+		return true
+	}
+
+	oldBucket := s3Bucket
+	s3Bucket = "bucket"
+	t.Cleanup(func() { s3Bucket = oldBucket })
+
+	awsCfg := aws.Config{
+		Region: "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider(
+			"AKIDEXAMPLE", "topsecret", "sessiontoken"),
+	}
+	var buf bytes.Buffer
+	if err := printConfig(context.Background(), &buf, &awsCfg, s3.Client()); err != nil {
+		t.Fatalf("printConfig(): %v", err)
+	}
+
+	for _, secret := range []string{"EXAMPLE", "topsecret", "sessiontoken"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("%q isn't redacted in %s", secret, buf.String())
+		}
+	}
+
+	var cfg effectiveConfig
+	if err := json.Unmarshal(buf.Bytes(), &cfg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if cfg.BootstrapRegion != "us-east-1" {
+		t.Errorf("bootstrapRegion = %q, want %q", cfg.BootstrapRegion,
+			"us-east-1")
+	}
+	if cfg.Region != "eu-central-1" {
+		t.Errorf("region = %q, want %q (error: %s)", cfg.Region, "eu-central-1",
+			cfg.RegionError)
+	}
+
+	creds := cfg.Credentials
+	if creds.AccessKeyID != "AKID*******" {
+		t.Errorf("accessKeyId = %q, want %q", creds.AccessKeyID, "AKID*******")
+	}
+	if creds.SecretAccessKey != redacted || creds.SessionToken != redacted {
+		t.Errorf("secretAccessKey = %q, sessionToken = %q, want %q",
+			creds.SecretAccessKey, creds.SessionToken, redacted)
+	}
+}
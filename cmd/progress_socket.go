@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	socketWriteTimeout = time.Second
+	socketHistoryLen   = 100
+	// socketClientBuffer is max number of lines queued for a client. It must
+	// fit whole history.
+	socketClientBuffer = 4 * socketHistoryLen
+	// socketProgressInterval is interval of periodic progress events.
+	socketProgressInterval = 5 * time.Second
+)
+
+// progressEvent is a line of NDJSON stream of --progress-socket.
+type progressEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	Name  string    `json:"name"`
+	Size  int64     `json:"size,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// listenProgress returns progressSocket listening on unix socket path, or nil
+// if path is empty.
+func listenProgress(path string) (*progressSocket, error) {
+	if path == "" {
+		return nil, nil
+	} else if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen progress socket: %w", err)
+	}
+
+	s := &progressSocket{ln: ln, done: make(chan struct{})}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// removeStaleSocket removes socket file path, left by killed process, because
+// Listen can't reuse it. It returns an error, if path isn't a socket or some
+// process still listens on it.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("progress socket: %w", err)
+	} else if fi.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("progress socket %q exists and isn't a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, socketWriteTimeout)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("progress socket %q is used by another process", path)
+	}
+
+	log.Println("remove stale progress socket", path)
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove stale progress socket: %w", err)
+	}
+	return nil
+}
+
+// progressSocket streams NDJSON events to every connected client. Late
+// clients get recent events first, so they don't miss what happened before
+// they connected. Every client has own queue and writer, so Send never
+// blocks. Slow clients, which overflow their queue, are disconnected, and
+// clients, which failed a write, are removed right after that.
+type progressSocket struct {
+	ln   net.Listener
+	wg   sync.WaitGroup
+	done chan struct{}
+
+	mu      sync.Mutex
+	clients []*progressClient
+	history [][]byte
+}
+
+func (self *progressSocket) accept() {
+	defer self.wg.Done()
+	for {
+		conn, err := self.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println("progress socket:", err)
+			}
+			return
+		}
+
+		client := newProgressClient(conn)
+		self.mu.Lock()
+		for _, line := range self.history {
+			client.Send(line)
+		}
+		select {
+		case <-self.done:
+			// Close has already closed all clients.
+			client.Close()
+		default:
+			self.clients = append(self.clients, client)
+		}
+		self.mu.Unlock()
+
+		self.wg.Add(1)
+		go func() {
+			defer self.wg.Done()
+			client.Run()
+			self.remove(client)
+		}()
+	}
+}
+
+// remove closes client and removes it from connected clients, so nothing is
+// queued for it anymore.
+func (self *progressSocket) remove(client *progressClient) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	client.Close()
+	self.clients = slices.DeleteFunc(self.clients,
+		func(c *progressClient) bool { return c == client })
+}
+
+// Send queues ev for all connected clients. It's safe to call on nil
+// progressSocket.
+func (self *progressSocket) Send(ev progressEvent) {
+	if self == nil {
+		return
+	}
+	self.send(ev, true)
+}
+
+// send queues ev for all connected clients and keeps it for late clients, if
+// keep is true.
+func (self *progressSocket) send(ev progressEvent, keep bool) {
+	ev.Time = time.Now()
+	line, err := json.Marshal(&ev)
+	if err != nil {
+		log.Println("progress socket: marshal event:", err)
+		return
+	}
+	line = append(line, '\n')
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if keep {
+		if len(self.history) == socketHistoryLen {
+			self.history = self.history[1:]
+		}
+		self.history = append(self.history, line)
+	}
+
+	clients := self.clients[:0]
+	for _, client := range self.clients {
+		if client.Send(line) {
+			clients = append(clients, client)
+		}
+	}
+	clear(self.clients[len(clients):])
+	self.clients = clients
+}
+
+// Every sends event returned by fn every d, until the socket is closed.
+// Periodic events aren't replayed to late clients. It's safe to call on nil
+// progressSocket.
+func (self *progressSocket) Every(d time.Duration, fn func() progressEvent) {
+	if self == nil {
+		return
+	}
+
+	self.wg.Add(1)
+	go func() {
+		defer self.wg.Done()
+		t := time.NewTicker(d)
+		defer t.Stop()
+		for {
+			select {
+			case <-self.done:
+				return
+			case <-t.C:
+				self.send(fn(), false)
+			}
+		}
+	}()
+}
+
+// Close writes queued events, disconnects all clients and removes the socket.
+// It's safe to call on nil progressSocket.
+func (self *progressSocket) Close() error {
+	if self == nil {
+		return nil
+	}
+
+	close(self.done)
+	err := self.ln.Close()
+	self.mu.Lock()
+	for _, client := range self.clients {
+		client.Close()
+	}
+	self.clients = nil
+	self.mu.Unlock()
+	self.wg.Wait()
+
+	// Listener removes the socket file by itself.
+	if err != nil {
+		return fmt.Errorf("close progress socket: %w", err)
+	}
+	return nil
+}
+
+// ==================================================
+
+func newProgressClient(conn net.Conn) *progressClient {
+	return &progressClient{
+		conn:  conn,
+		lines: make(chan []byte, socketClientBuffer),
+	}
+}
+
+// progressClient is a client of progressSocket, with queue of lines for it.
+type progressClient struct {
+	conn  net.Conn
+	lines chan []byte
+
+	closed bool
+}
+
+// Send queues line and returns true, or closes the client and returns false,
+// if its queue is full. It must be called with locked mu of progressSocket.
+func (self *progressClient) Send(line []byte) bool {
+	if self.closed {
+		return false
+	}
+
+	select {
+	case self.lines <- line:
+		return true
+	default:
+		self.Close()
+		return false
+	}
+}
+
+// Close closes queue of the client, so Run exits after writing everything
+// queued. It must be called with locked mu of progressSocket.
+func (self *progressClient) Close() {
+	if !self.closed {
+		self.closed = true
+		close(self.lines)
+	}
+}
+
+// Run writes queued lines to the client, until its queue is closed or write
+// failed, and disconnects the client after that.
+func (self *progressClient) Run() {
+	defer self.conn.Close()
+	for line := range self.lines {
+		_ = self.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+		if _, err := self.conn.Write(line); err != nil {
+			break
+		}
+	}
+}
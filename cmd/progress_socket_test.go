@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// listenTestProgress returns progressSocket on a short path, because path of
+// unix socket is limited.
+func listenTestProgress(t *testing.T) (*progressSocket, string) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "dbcopy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "progress.sock")
+	sock, err := listenProgress(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sock.Close() })
+	return sock, path
+}
+
+func TestProgressSocket_historyAndPeriodic(t *testing.T) {
+	sock, path := listenTestProgress(t)
+	sock.Send(progressEvent{Event: "download", Name: "foo"})
+	sock.Send(progressEvent{Event: "started", Name: "bar"})
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sock.Every(10*time.Millisecond, func() progressEvent {
+		return progressEvent{Event: "progress", Name: "foo", Size: 42}
+	})
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	scanner := bufio.NewScanner(conn)
+	want := []progressEvent{
+		{Event: "download", Name: "foo"},
+		{Event: "started", Name: "bar"},
+		{Event: "progress", Name: "foo", Size: 42},
+		{Event: "progress", Name: "foo", Size: 42},
+	}
+	for i, want := range want {
+		if !scanner.Scan() {
+			t.Fatalf("line %d: %v", i, scanner.Err())
+		}
+		var ev progressEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		} else if ev.Time.IsZero() {
+			t.Errorf("line %d: no time", i)
+		}
+		ev.Time = time.Time{}
+		if ev != want {
+			t.Errorf("line %d = %+v, want %+v", i, ev, want)
+		}
+	}
+}
+
+func TestProgressSocket_dropFailedClient(t *testing.T) {
+	sock, path := listenTestProgress(t)
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients := func() int {
+		sock.mu.Lock()
+		defer sock.mu.Unlock()
+		return len(sock.clients)
+	}
+	for clients() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	conn.Close()
+
+	// A single event can't overflow the queue, so only failed write removes
+	// the client.
+	sock.Send(progressEvent{Event: "started", Name: "foo"})
+	deadline := time.Now().Add(time.Second)
+	for clients() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("disconnected client is still in the list")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
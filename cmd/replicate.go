@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Max size of object, which can be copied by single CopyObject.
+	maxCopySize  = 5 << 30
+	copyPartSize = 512 << 20
+
+	replicateTimeout = 12 * time.Hour
+)
+
+var (
+	replicateCmd = cobra.Command{
+		Use:                   "replicate -b my-bucket -d dest-bucket [-d dest-bucket...] name",
+		Short:                 "Copy name.bz2.crypt and its markers into other buckets",
+		Args:                  cobra.ExactArgs(1),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := rootSetup(); err != nil {
+				return err
+			}
+
+			ctx, cancel := commandContext(replicateTimeout)
+			defer cancel()
+			return NewReplicate(s3Client, s3Bucket).Run(ctx, objectName(args[0]),
+				replicateDests...)
+		},
+	}
+
+	replicateDests []string
+)
+
+func init() {
+	replicateCmd.Flags().StringSliceVarP(&replicateDests, "dest-bucket", "d",
+		nil, "destination bucket")
+	_ = replicateCmd.MarkFlagRequired("dest-bucket")
+}
+
+func NewReplicate(client *s3.Client, bucket string) *Replicate {
+	return &Replicate{client: client, bucket: bucket}
+}
+
+type Replicate struct {
+	client *s3.Client
+	bucket string
+}
+
+// Run copies name.bz2.crypt and existing markers into every dest bucket
+// concurrently. Markers are copied in the same order, like producer writes
+// them, so a wait on dest bucket sees .ok after the data.
+func (self *Replicate) Run(ctx context.Context, name string, dests ...string,
+) error {
+	errs := make([]error, len(dests))
+	var wg sync.WaitGroup
+	for i, dest := range dests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := self.replicate(ctx, name, dest); err != nil {
+				log.Printf("✗ %s: %v", dest, err)
+				errs[i] = fmt.Errorf("replicate to %q: %w", dest, err)
+				return
+			}
+			log.Printf("✓ %s", dest)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (self *Replicate) replicate(ctx context.Context, name, dest string) error {
+	client, err := bucketClient(ctx, self.client, dest)
+	if err != nil {
+		return err
+	}
+
+	for _, ext := range [...]string{startedExt, errorExt, sqlExt, okExt} {
+		key := name + ext
+		h, err := self.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(self.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			var notFound *types.NotFound
+			if ext != sqlExt && errors.As(err, &notFound) {
+				continue
+			}
+			return fmt.Errorf("heading %q: %w", key, err)
+		}
+
+		if err := self.copyObject(ctx, client, dest, key, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *Replicate) copyObject(ctx context.Context, client *s3.Client,
+	dest, key string, h *s3.HeadObjectOutput,
+) error {
+	source := url.PathEscape(self.bucket + "/" + key)
+	if aws.ToInt64(h.ContentLength) > maxCopySize {
+		return copyMultipart(ctx, client, dest, key, source, h, "")
+	}
+
+	_, err := client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(dest),
+		Key:        aws.String(key),
+		CopySource: aws.String(source),
+	})
+	if err != nil {
+		return fmt.Errorf("copy %q: %w", key, err)
+	}
+	return nil
+}
+
+// copyMultipart copies source with head h into key of dest bucket by parts,
+// because single CopyObject can't copy objects bigger than 5GiB. If class
+// isn't empty, the copy has this storage class.
+func copyMultipart(ctx context.Context, client *s3.Client,
+	dest, key, source string, h *s3.HeadObjectOutput, class types.StorageClass,
+) error {
+	upload, err := client.CreateMultipartUpload(ctx,
+		&s3.CreateMultipartUploadInput{
+			Bucket:       aws.String(dest),
+			Key:          aws.String(key),
+			ContentType:  h.ContentType,
+			Metadata:     h.Metadata,
+			StorageClass: class,
+		})
+	if err != nil {
+		return fmt.Errorf("create multipart upload of %q: %w", key, err)
+	}
+
+	parts, err := copyParts(ctx, client, upload, source,
+		aws.ToInt64(h.ContentLength))
+	if err != nil {
+		_, _ = client.AbortMultipartUpload(context.WithoutCancel(ctx),
+			&s3.AbortMultipartUploadInput{
+				Bucket:   upload.Bucket,
+				Key:      upload.Key,
+				UploadId: upload.UploadId,
+			})
+		return fmt.Errorf("copy parts of %q: %w", key, err)
+	}
+
+	_, err = client.CompleteMultipartUpload(ctx,
+		&s3.CompleteMultipartUploadInput{
+			Bucket:          upload.Bucket,
+			Key:             upload.Key,
+			UploadId:        upload.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	if err != nil {
+		return fmt.Errorf("complete multipart upload of %q: %w", key, err)
+	}
+	return nil
+}
+
+func copyParts(ctx context.Context, client *s3.Client,
+	upload *s3.CreateMultipartUploadOutput, source string, size int64,
+) ([]types.CompletedPart, error) {
+	parts := make([]types.CompletedPart, 0, (size+copyPartSize-1)/copyPartSize)
+	for offset := int64(0); offset < size; offset += copyPartSize {
+		partNum := aws.Int32(int32(len(parts) + 1))
+		last := min(offset+copyPartSize, size) - 1
+		resp, err := client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:     upload.Bucket,
+			Key:        upload.Key,
+			UploadId:   upload.UploadId,
+			PartNumber: partNum,
+			CopySource: aws.String(source),
+			CopySourceRange: aws.String("bytes=" + strconv.FormatInt(offset, 10) +
+				"-" + strconv.FormatInt(last, 10)),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("copy part %v: %w", *partNum, err)
+		}
+		parts = append(parts, types.CompletedPart{
+			ETag:       resp.CopyPartResult.ETag,
+			PartNumber: partNum,
+		})
+	}
+	return parts, nil
+}
@@ -1,17 +1,43 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/charmbracelet/lipgloss"
 	dotenv "github.com/dsh2dsh/expx-dotenv"
+	"github.com/muesli/termenv"
 	"github.com/spf13/cobra"
 )
 
+const (
+	prefixEnv = "DBCOPY_PREFIX"
+
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+
+	setupTimeout = time.Minute
+
+	defaultBootstrapRegion = "us-east-1"
+)
+
 var (
 	rootCmd = cobra.Command{
 		Use: "dbcopy",
@@ -24,14 +50,83 @@ var (
 
 	s3Client *s3.Client
 	s3Bucket string
+	logFile  string
+	s3Prefix string
+
+	useAccelerate  bool
+	printCfg       bool
+	commandTimeout time.Duration
+
+	staticCreds struct {
+		AccessKeyID     string
+		SecretAccessKey string
+		SessionToken    string
+	}
+	credentialsFile string
+	noSignRequest   bool
+	profileChain    []string
+
+	quietSuccess bool
+	quietLog     bytes.Buffer
+
+	colorMode = colorAuto
+
+	progressSocketPath string
+	endpointDebug      bool
+	bootstrapRegion    = defaultBootstrapRegion
 )
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&s3Bucket, "bucket", "b", "",
 		"S3 bucket")
-	_ = rootCmd.MarkPersistentFlagRequired("bucket")
+	rootCmd.PersistentFlags().StringVar(&s3Prefix, "prefix", "",
+		"key prefix of objects, like backups/prod/ (env "+prefixEnv+")")
+	rootCmd.PersistentFlags().BoolVar(&useAccelerate, "use-accelerate", false,
+		"use S3 Transfer Acceleration endpoint")
+	rootCmd.PersistentFlags().BoolVar(&printCfg, "print-config", false,
+		"print effective configuration and exit")
+	rootCmd.PersistentFlags().DurationVar(&commandTimeout, "command-timeout", 0,
+		"max run time of command (default depends on command)")
 
+	rootCmd.PersistentFlags().StringVar(&staticCreds.AccessKeyID,
+		"access-key-id", "", "use this access key, instead of default credentials")
+	rootCmd.PersistentFlags().StringVar(&staticCreds.SecretAccessKey,
+		"secret-access-key", "", "secret key of --access-key-id")
+	rootCmd.PersistentFlags().StringVar(&staticCreds.SessionToken,
+		"session-token", "", "session token of --access-key-id")
+	rootCmd.PersistentFlags().StringVar(&credentialsFile, "credentials-file", "",
+		"use this shared credentials file, instead of ~/.aws/credentials")
+	rootCmd.PersistentFlags().BoolVar(&quietSuccess, "quiet-success", false,
+		"print nothing on success, but everything on failure")
+	rootCmd.PersistentFlags().StringVar(&colorMode, "color", colorMode,
+		"colorize output: auto, always or never")
+	rootCmd.PersistentFlags().BoolVar(&noSignRequest, "no-sign-request", false,
+		"send requests unsigned, for proxies, which sign them by themselves")
+	rootCmd.PersistentFlags().StringVar(&progressSocketPath, "progress-socket",
+		"", "stream NDJSON progress events to clients of this unix socket")
+	rootCmd.PersistentFlags().BoolVar(&endpointDebug, "endpoint-resolver-debug",
+		false, "log resolved endpoint of every S3 request")
+	rootCmd.PersistentFlags().StringSliceVar(&profileChain, "profile-chain",
+		nil, "use the first of these profiles with working credentials")
+	rootCmd.PersistentFlags().StringVar(&bootstrapRegion, "bootstrap-region",
+		bootstrapRegion, "region of the client, which detects region of buckets")
+	rootCmd.MarkFlagsRequiredTogether("access-key-id", "secret-access-key")
+	rootCmd.MarkFlagsMutuallyExclusive("access-key-id", "credentials-file",
+		"no-sign-request")
+	rootCmd.MarkFlagsMutuallyExclusive("access-key-id", "no-sign-request",
+		"profile-chain")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "",
+		"append log records to this file instead of stderr")
+
+	rootCmd.AddCommand(&benchmarkCmd)
 	rootCmd.AddCommand(&catCmd)
+	rootCmd.AddCommand(&getCmd)
+	rootCmd.AddCommand(&markersCmd)
+	rootCmd.AddCommand(&putCmd)
+	rootCmd.AddCommand(&replicateCmd)
+	rootCmd.AddCommand(&selfupdateCmd)
+	rootCmd.AddCommand(&transitionCmd)
+	rootCmd.AddCommand(&verifyCmd)
 	rootCmd.AddCommand(&waitCmd)
 }
 
@@ -40,16 +135,67 @@ func Execute(version string) {
 		rootCmd.Version = version
 	}
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *exitError
+		hasCode := errors.As(err, &exitErr)
+		if errors.Is(err, errPrintedConfig) {
+			return
+		} else if rootCmd.SilenceErrors && !(hasCode && exitErr.quiet) {
+			// Errors are silenced by setupQuiet.
+			_, _ = quietLog.WriteTo(os.Stderr)
+			rootCmd.PrintErrln("Error:", err)
+		}
+
+		if hasCode {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(1)
 	}
 }
 
+// exitError is an error, which exits with specific code, instead of 1. Quiet
+// exitError is an expected outcome, like not modified object, so it isn't
+// printed.
+type exitError struct {
+	code  int
+	err   error
+	quiet bool
+}
+
+// silenceQuiet configures cmd to not print err, if it's quiet exitError.
+func silenceQuiet(cmd *cobra.Command, err error) {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) && exitErr.quiet {
+		cmd.SilenceErrors = true
+	}
+}
+
+func (self *exitError) Error() string { return self.err.Error() }
+
+func (self *exitError) Unwrap() error { return self.err }
+
+// rootSetup configures everything needed for commands, which work with S3
+// bucket.
 func rootSetup() error {
-	if err := loadEnvs(); err != nil {
+	if s3Bucket == "" {
+		// Not marked as required, because some commands don't need it.
+		return errors.New(`required flag(s) "bucket" not set`)
+	} else if err := loadEnvs(); err != nil {
+		return err
+	} else if err := setupColors(os.Stderr); err != nil {
+		// After loadEnvs, because termenv reads NO_COLOR and CLICOLOR_FORCE.
+		return err
+	} else if err := setupLog(); err != nil {
 		return err
 	}
+	setupQuiet()
+	setupPrefix()
 
-	if c, err := newS3Client(); err != nil {
+	if c, err := newS3Client(); errors.Is(err, errPrintedConfig) {
+		// It isn't a failure, don't print it and usage.
+		rootCmd.SilenceErrors = true
+		rootCmd.SilenceUsage = true
+		return err
+	} else if err != nil {
 		return err
 	} else {
 		s3Client = c
@@ -64,21 +210,313 @@ func loadEnvs() error {
 	return nil
 }
 
+// setupLog redirects log output to logFile, if it's configured. The file is
+// opened in append mode and every log record is written by single write call
+// without buffering, so external logrotate can use copytruncate.
+func setupLog() error {
+	if logFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	log.SetOutput(f)
+	return nil
+}
+
+// commandContext returns context with deadline of --command-timeout, or def,
+// if it isn't configured, so no command can hang forever.
+func commandContext(def time.Duration) (context.Context, context.CancelFunc) {
+	if commandTimeout > 0 {
+		return context.WithTimeout(context.Background(), commandTimeout)
+	}
+	return context.WithTimeout(context.Background(), def)
+}
+
+func setupPrefix() {
+	if !rootCmd.PersistentFlags().Changed("prefix") {
+		s3Prefix = os.Getenv(prefixEnv)
+	}
+}
+
+// objectName returns name with configured key prefix.
+func objectName(name string) string {
+	return s3Prefix + name
+}
+
+// setupColors configures default termenv output and lipgloss renderer for w,
+// according to --color. By default it's detected by termenv, which honors
+// NO_COLOR and checks w is a terminal.
+func setupColors(w io.Writer) error {
+	var opts []termenv.OutputOption
+	switch colorMode {
+	case colorAuto:
+	case colorAlways:
+		opts = append(opts, termenv.WithProfile(termenv.ANSI256))
+	case colorNever:
+		opts = append(opts, termenv.WithProfile(termenv.Ascii))
+	default:
+		return fmt.Errorf("unexpected --color=%q, expected %q, %q or %q",
+			colorMode, colorAuto, colorAlways, colorNever)
+	}
+
+	out := termenv.NewOutput(w, opts...)
+	termenv.SetDefaultOutput(out)
+	r := lipgloss.NewRenderer(w, opts...)
+	if colorMode != colorAuto {
+		// Renderer detects its profile by environment, ignoring the profile of
+		// its output.
+		r.SetColorProfile(out.Profile)
+	}
+	lipgloss.SetDefaultRenderer(r)
+	return nil
+}
+
+// setupQuiet holds log output in memory, until we know the command failed, if
+// --quiet-success configured.
+func setupQuiet() {
+	if !quietSuccess {
+		return
+	}
+
+	// Print errors after collected log output.
+	rootCmd.SilenceErrors = true
+	if logFile == "" {
+		log.SetOutput(&quietLog)
+	}
+}
+
+// logWriter writes everything into the log, so it's held with log output by
+// --quiet-success and printed only if the command failed.
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	log.Print(string(p))
+	return len(p), nil
+}
+
 func newS3Client() (*s3.Client, error) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+	defer cancel()
 
 	// Load the Shared AWS Configuration (~/.aws/config)
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("us-east-1"))
+	cfg, profile, err := loadConfig(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("aws config: %w", err)
+		return nil, err
+	}
+
+	if endpointDebug {
+		cfg.APIOptions = append(cfg.APIOptions, logEndpoint)
+	}
+	if noSignRequest {
+		cfg.APIOptions = append(cfg.APIOptions, removeSigning)
 	}
 
-	region, err := manager.GetBucketRegion(ctx, s3.NewFromConfig(cfg), s3Bucket)
+	if printCfg {
+		err := printConfig(ctx, os.Stdout, &cfg, s3.NewFromConfig(cfg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, errPrintedConfig
+	}
+
+	if !noSignRequest {
+		if err := checkSSOLogin(ctx, cfg.Credentials, profile); err != nil {
+			return nil, err
+		}
+	}
+
+	// Fail before any request, if acceleration can't work anyway.
+	if useAccelerate && !accelerateBucketName(s3Bucket) {
+		return nil, fmt.Errorf(
+			"bucket %q isn't DNS-compliant and can't be used with acceleration",
+			s3Bucket)
+	}
+
+	region, err := bucketRegion(ctx, s3.NewFromConfig(cfg), s3Bucket)
 	if err != nil {
-		return nil, fmt.Errorf("region of bucket %q: %w", s3Bucket, err)
+		return nil, err
 	}
 
 	// Create an Amazon S3 service client
-	client := s3.NewFromConfig(cfg, func(o *s3.Options) { o.Region = region })
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.Region = region
+		o.UseAccelerate = useAccelerate
+	})
 	return client, nil
 }
+
+// loadConfig loads default config or config of the first profile of
+// --profile-chain, which has working credentials. It returns selected
+// profile, or empty string, if --profile-chain isn't configured.
+func loadConfig(ctx context.Context) (aws.Config, string, error) {
+	if len(profileChain) == 0 {
+		cfg, err := config.LoadDefaultConfig(ctx, configOptions()...)
+		if err != nil {
+			return cfg, "", fmt.Errorf("aws config: %w", err)
+		}
+		return cfg, "", nil
+	}
+
+	var errs []error
+	for _, profile := range profileChain {
+		cfg, err := config.LoadDefaultConfig(ctx, append(configOptions(),
+			config.WithSharedConfigProfile(profile))...)
+		if err == nil {
+			err = checkProfile(ctx, &cfg, profile)
+		}
+		if err == nil {
+			return cfg, profile, nil
+		}
+		log.Printf("profile %q: %v", profile, err)
+		errs = append(errs, fmt.Errorf("profile %q: %w", profile, err))
+	}
+	return aws.Config{}, "", fmt.Errorf(
+		"no profile with working credentials: %w", errors.Join(errs...))
+}
+
+// checkProfile returns an error, if credentials of profile don't work. Some
+// credentials can be retrieved, but still be rejected, like keys of deleted
+// user, so it asks STS who they are.
+func checkProfile(ctx context.Context, cfg *aws.Config, profile string) error {
+	if cfg.Credentials == nil {
+		return errors.New("no credentials")
+	} else if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return ssoLoginHint(err, profile)
+	}
+
+	_, err := sts.NewFromConfig(*cfg).GetCallerIdentity(ctx,
+		&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("get caller identity: %w", err)
+	}
+	return nil
+}
+
+func configOptions() []func(*config.LoadOptions) error {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(bootstrapRegion)}
+	if noSignRequest {
+		// Credentials aren't used, but don't look for them.
+		opts = append(opts, config.WithCredentialsProvider(
+			aws.AnonymousCredentials{}))
+	} else if staticCreds.AccessKeyID != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(staticCreds.AccessKeyID,
+				staticCreds.SecretAccessKey, staticCreds.SessionToken)))
+	} else if credentialsFile != "" {
+		opts = append(opts,
+			config.WithSharedCredentialsFiles([]string{credentialsFile}))
+	}
+	return opts
+}
+
+// removeSigning removes signing middleware from stack, so requests are sent
+// unsigned. It's unlike anonymous credentials, which still run the signer.
+func removeSigning(stack *middleware.Stack) error {
+	if _, err := stack.Finalize.Remove("Signing"); err != nil {
+		return fmt.Errorf("remove signing middleware: %w", err)
+	}
+	return nil
+}
+
+// logEndpoint adds middleware, which logs resolved endpoint of every request,
+// right after it's resolved.
+func logEndpoint(stack *middleware.Stack) error {
+	err := stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc(
+		"LogEndpoint",
+		func(ctx context.Context, in middleware.FinalizeInput,
+			next middleware.FinalizeHandler,
+		) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			if req, ok := in.Request.(*smithyhttp.Request); ok {
+				log.Printf("%s %s: %s %s", awsmiddleware.GetServiceID(ctx),
+					awsmiddleware.GetOperationName(ctx), req.Method, req.URL)
+			}
+			return next.HandleFinalize(ctx, in)
+		}), "ResolveEndpointV2", middleware.After)
+	if err != nil {
+		return fmt.Errorf("add endpoint logging middleware: %w", err)
+	}
+	return nil
+}
+
+// bucketClient returns a copy of client, configured for region of bucket.
+func bucketClient(ctx context.Context, client *s3.Client, bucket string,
+) (*s3.Client, error) {
+	region, err := bucketRegion(ctx, client, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(client.Options(), func(o *s3.Options) { o.Region = region }),
+		nil
+}
+
+// bucketRegion returns region of bucket. It's the first request to the
+// bucket, so it returns an error, if bucket doesn't exist, and nothing waits
+// for objects in this bucket until timeout.
+func bucketRegion(ctx context.Context, client *s3.Client, bucket string,
+) (string, error) {
+	region, err := manager.GetBucketRegion(ctx, client, bucket)
+	var notFound manager.BucketNotFound
+	if errors.As(err, &notFound) {
+		return "", fmt.Errorf("bucket %q not found: %w", bucket, err)
+	} else if err != nil {
+		return "", fmt.Errorf("region of bucket %q: %w", bucket, err)
+	}
+	return region, nil
+}
+
+// checkSSOLogin retrieves credentials of profile and returns an error with
+// exact login command, if they are from expired SSO session. Empty profile
+// means AWS_PROFILE. Any other errors are ignored, because they'll be
+// returned later by the actual call.
+func checkSSOLogin(ctx context.Context, p aws.CredentialsProvider,
+	profile string,
+) error {
+	if p == nil {
+		return nil
+	}
+
+	var tokenErr *ssocreds.InvalidTokenError
+	if _, err := p.Retrieve(ctx); err != nil && errors.As(err, &tokenErr) {
+		return ssoLoginHint(err, profile)
+	}
+	return nil
+}
+
+// ssoLoginHint returns err with exact login command, if it's an error of
+// expired SSO session of profile. Empty profile means AWS_PROFILE.
+func ssoLoginHint(err error, profile string) error {
+	var tokenErr *ssocreds.InvalidTokenError
+	if !errors.As(err, &tokenErr) {
+		return err
+	}
+
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	cmd := "aws sso login"
+	if profile != "" {
+		cmd += " --profile " + profile
+	}
+	return fmt.Errorf("SSO session expired, run %q to login: %w", cmd, err)
+}
+
+// accelerateBucketName returns true if bucket name can be used with S3
+// Transfer Acceleration: it must be DNS-compliant and must not contain dots.
+func accelerateBucketName(name string) bool {
+	if len(name) < 3 || len(name) > 63 {
+		return false
+	}
+
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-' && i > 0 && i < len(name)-1:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,499 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+func TestRemoveSigning(t *testing.T) {
+	tests := []struct {
+		name     string
+		apiOpts  []func(*middleware.Stack) error
+		wantAuth bool
+	}{
+		{name: "signed", wantAuth: true},
+		{
+			name:    "unsigned",
+			apiOpts: []func(*middleware.Stack) error{removeSigning},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo", []byte("content"))
+			var mu sync.Mutex
+			var auth []string
+			fake.Handler = func(w http.ResponseWriter, r *http.Request) bool {
+				mu.Lock()
+				auth = append(auth, r.Header.Get("Authorization"))
+				mu.Unlock()
+				return false
+			}
+
+			client := s3.New(fake.Client().Options(), func(o *s3.Options) {
+				o.APIOptions = append(o.APIOptions, tt.apiOpts...)
+			})
+			_, err := client.HeadObject(context.Background(),
+				&s3.HeadObjectInput{
+					Bucket: aws.String("bucket"),
+					Key:    aws.String("foo"),
+				})
+			if err != nil {
+				t.Fatalf("HeadObject(): %v", err)
+			}
+
+			if len(auth) != 1 {
+				t.Fatalf("%d requests, want 1", len(auth))
+			} else if got := auth[0] != ""; got != tt.wantAuth {
+				t.Errorf("Authorization = %q, want present %v", auth[0], tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestSSOLoginHint(t *testing.T) {
+	tokenErr := &ssocreds.InvalidTokenError{Err: errors.New("token expired")}
+	tests := []struct {
+		name       string
+		err        error
+		profile    string
+		envProfile string
+		wantCmd    string
+	}{
+		{name: "not sso", err: errors.New("no credentials")},
+		{name: "default profile", err: tokenErr, wantCmd: "aws sso login"},
+		{
+			name:       "env profile",
+			err:        tokenErr,
+			envProfile: "dev",
+			wantCmd:    "aws sso login --profile dev",
+		},
+		{
+			name:       "selected profile",
+			err:        fmt.Errorf("retrieve: %w", tokenErr),
+			profile:    "prod",
+			envProfile: "dev",
+			wantCmd:    "aws sso login --profile prod",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_PROFILE", tt.envProfile)
+			err := ssoLoginHint(tt.err, tt.profile)
+			if tt.wantCmd == "" {
+				if err != tt.err { //nolint:errorlint // must be the same error
+					t.Errorf("ssoLoginHint() = %v, want %v", err, tt.err)
+				}
+				return
+			}
+
+			want := fmt.Sprintf("SSO session expired, run %q to login: ",
+				tt.wantCmd)
+			if got := err.Error(); !strings.HasPrefix(got, want) {
+				t.Errorf("ssoLoginHint() = %q, want %q in front", got, want)
+			} else if !errors.Is(err, tt.err) {
+				t.Errorf("ssoLoginHint() = %v, want it wraps %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// fakeSTS answers GetCallerIdentity, rejecting access key badKey.
+func fakeSTS(t *testing.T, badKey string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/xml")
+			if strings.Contains(r.Header.Get("Authorization"),
+				"Credential="+badKey+"/") {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, "<ErrorResponse><Error><Type>Sender</Type>"+
+					"<Code>InvalidClientTokenId</Code>"+
+					"<Message>The security token is invalid.</Message>"+
+					"</Error><RequestId>1</RequestId></ErrorResponse>")
+				return
+			}
+			fmt.Fprint(w, "<GetCallerIdentityResponse><GetCallerIdentityResult>"+
+				"<Arn>arn:aws:iam::123456789012:user/good</Arn>"+
+				"<UserId>AIDAGOOD</UserId><Account>123456789012</Account>"+
+				"</GetCallerIdentityResult><ResponseMetadata>"+
+				"<RequestId>1</RequestId></ResponseMetadata>"+
+				"</GetCallerIdentityResponse>")
+		}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLoadConfig_profileChain(t *testing.T) {
+	sts := fakeSTS(t, "AKIDREJECTED")
+	dir := t.TempDir()
+	creds := filepath.Join(dir, "credentials")
+	err := os.WriteFile(creds, []byte(`[rejected]
+aws_access_key_id = AKIDREJECTED
+aws_secret_access_key = secret
+
+[good]
+aws_access_key_id = AKIDGOOD
+aws_secret_access_key = secret
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", creds)
+	t.Setenv("AWS_ENDPOINT_URL", sts.URL)
+	t.Setenv("AWS_PROFILE", "")
+
+	oldChain := profileChain
+	t.Cleanup(func() { profileChain = oldChain })
+
+	tests := []struct {
+		name    string
+		chain   []string
+		want    string
+		wantErr bool
+	}{
+		{name: "skip rejected", chain: []string{"rejected", "good"}, want: "good"},
+		{name: "first good", chain: []string{"good", "rejected"}, want: "good"},
+		{name: "missing", chain: []string{"missing", "good"}, want: "good"},
+		{name: "all rejected", chain: []string{"rejected"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profileChain = tt.chain
+			cfg, profile, err := loadConfig(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("loadConfig() = %q, want error", profile)
+				} else if !strings.Contains(err.Error(), "InvalidClientTokenId") {
+					t.Errorf("loadConfig() = %v, want STS error", err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("loadConfig(): %v", err)
+			}
+
+			if profile != tt.want {
+				t.Errorf("profile = %q, want %q", profile, tt.want)
+			}
+			creds, err := cfg.Credentials.Retrieve(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			} else if creds.AccessKeyID != "AKIDGOOD" {
+				t.Errorf("access key %q, want AKIDGOOD", creds.AccessKeyID)
+			}
+		})
+	}
+}
+
+func TestAccelerateBucketName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "my-bucket", want: true},
+		{name: "bucket1", want: true},
+		{name: "abc", want: true},
+		{name: strings.Repeat("a", 63), want: true},
+		{name: "my.bucket", want: false},
+		{name: "ab", want: false},
+		{name: strings.Repeat("a", 64), want: false},
+		{name: "My-Bucket", want: false},
+		{name: "my_bucket", want: false},
+		{name: "-bucket", want: false},
+		{name: "bucket-", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accelerateBucketName(tt.name); got != tt.want {
+				t.Errorf("accelerateBucketName(%q) = %v, want %v", tt.name, got,
+					tt.want)
+			}
+		})
+	}
+}
+
+func TestSetupLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dbcopy.log")
+	if err := os.WriteFile(path, []byte("old record\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	oldFile, oldOutput, oldFlags := logFile, log.Writer(), log.Flags()
+	logFile = path
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		logFile = oldFile
+		log.SetOutput(oldOutput)
+		log.SetFlags(oldFlags)
+	})
+
+	if err := setupLog(); err != nil {
+		t.Fatalf("setupLog(): %v", err)
+	}
+	log.Println("new record")
+
+	// Records are written without buffering, so they're in the file already.
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := string(b), "old record\nnew record\n"; got != want {
+		t.Errorf("log file %q, want %q", got, want)
+	}
+}
+
+func TestSetupPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		flag string
+		want string
+	}{
+		{name: "env", want: "env/"},
+		{name: "flag", flag: "flag/", want: "flag/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(prefixEnv, "env/")
+			oldPrefix := s3Prefix
+			flag := rootCmd.PersistentFlags().Lookup("prefix")
+			t.Cleanup(func() {
+				s3Prefix = oldPrefix
+				flag.Changed = false
+			})
+
+			if tt.flag != "" {
+				if err := flag.Value.Set(tt.flag); err != nil {
+					t.Fatal(err)
+				}
+				flag.Changed = true
+			}
+			setupPrefix()
+
+			if got, want := objectName("foo"), tt.want+"foo"; got != want {
+				t.Errorf("objectName() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestConfigOptions_credentials(t *testing.T) {
+	dir := t.TempDir()
+	creds := filepath.Join(dir, "credentials")
+	err := os.WriteFile(creds, []byte(`[default]
+aws_access_key_id = AKIDFILE
+aws_secret_access_key = secret
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "missing"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	oldCreds, oldFile := staticCreds, credentialsFile
+	t.Cleanup(func() { staticCreds, credentialsFile = oldCreds, oldFile })
+
+	tests := []struct {
+		name      string
+		accessKey string
+		file      string
+		wantKey   string
+		wantToken string
+	}{
+		{
+			name:      "static",
+			accessKey: "AKIDSTATIC",
+			wantKey:   "AKIDSTATIC",
+			wantToken: "token",
+		},
+		{name: "credentials file", file: creds, wantKey: "AKIDFILE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			staticCreds.AccessKeyID = tt.accessKey
+			staticCreds.SecretAccessKey = "secret"
+			staticCreds.SessionToken = "token"
+			credentialsFile = tt.file
+
+			ctx := context.Background()
+			cfg, err := config.LoadDefaultConfig(ctx, configOptions()...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := cfg.Credentials.Retrieve(ctx)
+			if err != nil {
+				t.Fatalf("retrieve credentials: %v", err)
+			} else if got.AccessKeyID != tt.wantKey {
+				t.Errorf("access key %q, want %q", got.AccessKeyID, tt.wantKey)
+			} else if got.SessionToken != tt.wantToken {
+				t.Errorf("session token %q, want %q", got.SessionToken,
+					tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestConfigOptions_bootstrapRegion(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_REGION", "ap-south-1")
+
+	oldRegion, oldCreds := bootstrapRegion, staticCreds
+	t.Cleanup(func() { bootstrapRegion, staticCreds = oldRegion, oldCreds })
+	staticCreds.AccessKeyID = "AKIDSTATIC"
+	staticCreds.SecretAccessKey = "secret"
+
+	tests := []struct {
+		name   string
+		region string
+	}{
+		{name: "default", region: defaultBootstrapRegion},
+		{name: "configured", region: "eu-west-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bootstrapRegion = tt.region
+			fake := newFakeS3(t)
+			var auth string
+			fake.Handler = func(w http.ResponseWriter, r *http.Request) bool {
+				if r.Method != http.MethodHead || r.URL.Path != "/bucket" {
+					return false
+				}
+				auth = r.Header.Get("Authorization")
+				w.Header().Set("X-Amz-Bucket-Region", "eu-central-1")
+				return true
+			}
+
+			ctx := context.Background()
+			cfg, err := config.LoadDefaultConfig(ctx, configOptions()...)
+			if err != nil {
+				t.Fatal(err)
+			} else if cfg.Region != tt.region {
+				t.Errorf("region %q, want %q", cfg.Region, tt.region)
+			}
+
+			client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+				o.BaseEndpoint = aws.String(fake.URL)
+				o.UsePathStyle = true
+			})
+			if _, err := bucketRegion(ctx, client, "bucket"); err != nil {
+				t.Fatalf("bucketRegion(): %v", err)
+			}
+
+			// The probe is signed for the bootstrap region.
+			scope := "/" + tt.region + "/s3/aws4_request"
+			if !strings.Contains(auth, scope) {
+				t.Errorf("authorization %q, want %q in it", auth, scope)
+			}
+		})
+	}
+}
+
+func TestSetupColors(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		noColor string
+		want    termenv.Profile
+		wantErr bool
+	}{
+		{name: "always", mode: colorAlways, want: termenv.ANSI256},
+		{name: "never", mode: colorNever, want: termenv.Ascii},
+		{name: "auto not terminal", mode: colorAuto, want: termenv.Ascii},
+		{
+			name:    "always with NO_COLOR",
+			mode:    colorAlways,
+			noColor: "1",
+			want:    termenv.ANSI256,
+		},
+		{name: "unexpected", mode: "rainbow", wantErr: true},
+	}
+
+	oldMode := colorMode
+	oldOutput, oldRenderer := termenv.DefaultOutput(), lipgloss.DefaultRenderer()
+	t.Cleanup(func() {
+		colorMode = oldMode
+		termenv.SetDefaultOutput(oldOutput)
+		lipgloss.SetDefaultRenderer(oldRenderer)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			colorMode = tt.mode
+			err := setupColors(io.Discard)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("setupColors() = nil, want error")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("setupColors(): %v", err)
+			}
+
+			if got := lipgloss.DefaultRenderer().ColorProfile(); got != tt.want {
+				t.Errorf("color profile %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogEndpoint(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.Put("bucket", "foo", []byte("content"))
+
+	oldOutput, oldFlags := log.Writer(), log.Flags()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(oldOutput)
+		log.SetFlags(oldFlags)
+	})
+
+	client := s3.New(fake.Client().Options(), func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, logEndpoint)
+	})
+	_, err := client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("foo"),
+	})
+	if err != nil {
+		t.Fatalf("HeadObject(): %v", err)
+	}
+
+	want := "S3 HeadObject: HEAD " + fake.URL + "/bucket/foo"
+	if !strings.HasPrefix(buf.String(), want) {
+		t.Errorf("log %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,423 @@
+package cmd
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakeObject is an object stored by fakeS3.
+type fakeObject struct {
+	Body         []byte
+	PartSizes    []int
+	ContentType  string
+	StorageClass string
+	Metadata     map[string]string
+	Modified     time.Time
+}
+
+func (self *fakeObject) ETag() string {
+	sum := md5.Sum(self.Body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// fakeS3 is in-memory S3 of single region with path style addressing. It
+// implements only what the commands use. If Handler returns true, the request
+// is already served by it.
+type fakeS3 struct {
+	*httptest.Server
+
+	Handler func(w http.ResponseWriter, r *http.Request) bool
+
+	mu       sync.Mutex
+	objects  map[string]*fakeObject // bucket/key
+	uploads  map[string]map[int][]byte
+	requests []string
+	nextID   int
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	t.Helper()
+	f := &fakeS3{
+		objects: make(map[string]*fakeObject),
+		uploads: make(map[string]map[int][]byte),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// Client returns S3 client of the fake.
+func (self *fakeS3) Client() *s3.Client {
+	return s3.New(s3.Options{
+		BaseEndpoint: aws.String(self.URL),
+		UsePathStyle: true,
+		Region:       "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider(
+			"AKIDFAKE", "secret", ""),
+		RetryMaxAttempts: 1,
+	})
+}
+
+func (self *fakeS3) Put(bucket, key string, body []byte) *fakeObject {
+	return self.store(bucket, key, &fakeObject{Body: body})
+}
+
+func (self *fakeS3) store(bucket, key string, obj *fakeObject) *fakeObject {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	obj.Modified = time.Now()
+	self.objects[bucket+"/"+key] = obj
+	return obj
+}
+
+// PutParts puts multipart object of parts.
+func (self *fakeS3) PutParts(bucket, key string, parts ...[]byte) *fakeObject {
+	var body []byte
+	sizes := make([]int, len(parts))
+	for i, part := range parts {
+		body = append(body, part...)
+		sizes[i] = len(part)
+	}
+	return self.store(bucket, key, &fakeObject{Body: body, PartSizes: sizes})
+}
+
+func (self *fakeS3) Get(bucket, key string) (*fakeObject, bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	obj, ok := self.objects[bucket+"/"+key]
+	return obj, ok
+}
+
+// Requests returns "METHOD path?query" of all served requests.
+func (self *fakeS3) Requests() []string {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return slices.Clone(self.requests)
+}
+
+func (self *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	self.mu.Lock()
+	self.requests = append(self.requests, r.Method+" "+r.URL.RequestURI())
+	self.mu.Unlock()
+	if self.Handler != nil && self.Handler(w, r) {
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && key == "" && q.Get("list-type") == "2":
+		self.list(w, bucket, q)
+	case r.Method == http.MethodHead && key == "":
+		w.Header().Set("X-Amz-Bucket-Region", "us-east-1")
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		self.get(w, r, bucket, key)
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		self.uploadPart(w, r, q)
+	case r.Method == http.MethodPut:
+		self.put(w, r, bucket, key)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		self.createUpload(w, bucket, key)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		self.completeUpload(w, r, bucket, key, q.Get("uploadId"))
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		self.mu.Lock()
+		delete(self.uploads, q.Get("uploadId"))
+		self.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		self.mu.Lock()
+		delete(self.objects, bucket+"/"+key)
+		self.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func writeFakeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>",
+		code, code)
+}
+
+func (self *fakeS3) get(w http.ResponseWriter, r *http.Request, bucket,
+	key string,
+) {
+	obj, ok := self.Get(bucket, key)
+	if !ok {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeFakeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	etag := obj.ETag()
+	if m := r.Header.Get("If-None-Match"); m != "" && m == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	} else if m := r.Header.Get("If-Match"); m != "" && m != etag {
+		writeFakeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Last-Modified", obj.Modified.UTC().Format(http.TimeFormat))
+	if obj.ContentType != "" {
+		h.Set("Content-Type", obj.ContentType)
+	}
+	if obj.StorageClass != "" {
+		h.Set("X-Amz-Storage-Class", obj.StorageClass)
+	}
+	for k, v := range obj.Metadata {
+		h.Set("X-Amz-Meta-"+k, v)
+	}
+
+	body, status := obj.Body, http.StatusOK
+	if n, _ := strconv.Atoi(r.URL.Query().Get("partNumber")); n > 0 &&
+		len(obj.PartSizes) > 0 {
+		first := 0
+		for _, size := range obj.PartSizes[:n-1] {
+			first += size
+		}
+		last := first + obj.PartSizes[n-1] - 1
+		h.Set("X-Amz-Mp-Parts-Count", strconv.Itoa(len(obj.PartSizes)))
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last,
+			len(body)))
+		body, status = body[first:last+1], http.StatusPartialContent
+	} else if rng := r.Header.Get("Range"); rng != "" {
+		var first, last int64
+		last = int64(len(body)) - 1
+		spec := strings.TrimPrefix(rng, "bytes=")
+		from, to, _ := strings.Cut(spec, "-")
+		first, _ = strconv.ParseInt(from, 10, 64)
+		if to != "" {
+			last, _ = strconv.ParseInt(to, 10, 64)
+		}
+		last = min(last, int64(len(body))-1)
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last,
+			len(body)))
+		body, status = body[first:last+1], http.StatusPartialContent
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(body)
+	}
+}
+
+func (self *fakeS3) put(w http.ResponseWriter, r *http.Request, bucket,
+	key string,
+) {
+	if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+		self.copyObject(w, r, bucket, key, src)
+		return
+	}
+
+	body, err := readFakeBody(r)
+	if err != nil {
+		writeFakeError(w, http.StatusBadRequest, "BadRequest")
+		return
+	}
+	obj := self.store(bucket, key, &fakeObject{
+		Body:         body,
+		ContentType:  r.Header.Get("Content-Type"),
+		StorageClass: r.Header.Get("X-Amz-Storage-Class"),
+	})
+	w.Header().Set("ETag", obj.ETag())
+}
+
+// readFakeBody reads body of r, decoding aws-chunked encoding of streaming
+// uploads with trailing checksum.
+func readFakeBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || !strings.Contains(r.Header.Get("Content-Encoding"),
+		"aws-chunked") {
+		return body, err //nolint:wrapcheck // it's a test
+	}
+
+	var out []byte
+	for {
+		line, rest, _ := strings.Cut(string(body), "\r\n")
+		size, err := strconv.ParseInt(strings.Split(line, ";")[0], 16, 64)
+		if err != nil {
+			return nil, err //nolint:wrapcheck // it's a test
+		} else if size == 0 {
+			return out, nil
+		}
+		out = append(out, rest[:size]...)
+		body = []byte(rest[size+2:])
+	}
+}
+
+func (self *fakeS3) copyObject(w http.ResponseWriter, r *http.Request,
+	bucket, key, src string,
+) {
+	src, _ = url.PathUnescape(src)
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+	obj, ok := self.Get(srcBucket, srcKey)
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	cp := *obj
+	cp.StorageClass = r.Header.Get("X-Amz-Storage-Class")
+	self.mu.Lock()
+	self.objects[bucket+"/"+key] = &cp
+	self.mu.Unlock()
+	fmt.Fprintf(w, "<CopyObjectResult><ETag>%s</ETag></CopyObjectResult>",
+		cp.ETag())
+}
+
+func (self *fakeS3) createUpload(w http.ResponseWriter, bucket, key string) {
+	self.mu.Lock()
+	self.nextID++
+	id := strconv.Itoa(self.nextID)
+	self.uploads[id] = make(map[int][]byte)
+	self.mu.Unlock()
+	fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>%s</Bucket>`+
+		`<Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`,
+		bucket, key, id)
+}
+
+func (self *fakeS3) uploadPart(w http.ResponseWriter, r *http.Request,
+	q url.Values,
+) {
+	n, _ := strconv.Atoi(q.Get("partNumber"))
+	var body []byte
+	if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+		src, _ = url.PathUnescape(src)
+		srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+		obj, ok := self.Get(srcBucket, srcKey)
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		var first, last int64
+		fmt.Sscanf(r.Header.Get("X-Amz-Copy-Source-Range"), "bytes=%d-%d",
+			&first, &last)
+		body = obj.Body[first : last+1]
+	} else {
+		b, err := readFakeBody(r)
+		if err != nil {
+			writeFakeError(w, http.StatusBadRequest, "BadRequest")
+			return
+		}
+		body = b
+	}
+
+	self.mu.Lock()
+	parts, ok := self.uploads[q.Get("uploadId")]
+	if ok {
+		parts[n] = body
+	}
+	self.mu.Unlock()
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	sum := md5.Sum(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		fmt.Fprintf(w, "<CopyPartResult><ETag>%s</ETag></CopyPartResult>", etag)
+	}
+}
+
+func (self *fakeS3) completeUpload(w http.ResponseWriter, r *http.Request,
+	bucket, key, id string,
+) {
+	self.mu.Lock()
+	parts, ok := self.uploads[id]
+	delete(self.uploads, id)
+	self.mu.Unlock()
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	nums := make([]int, 0, len(parts))
+	for n := range parts {
+		nums = append(nums, n)
+	}
+	slices.Sort(nums)
+	obj := &fakeObject{PartSizes: make([]int, len(nums))}
+	for i, n := range nums {
+		obj.Body = append(obj.Body, parts[n]...)
+		obj.PartSizes[i] = len(parts[n])
+	}
+	self.store(bucket, key, obj)
+	fmt.Fprintf(w, "<CompleteMultipartUploadResult><Key>%s</Key>"+
+		"<ETag>%s</ETag></CompleteMultipartUploadResult>", key, obj.ETag())
+}
+
+type fakeListResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	IsTruncated bool
+	Contents    []fakeListEntry
+}
+
+type fakeListEntry struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified string
+	StorageClass string
+}
+
+func (self *fakeS3) list(w http.ResponseWriter, bucket string, q url.Values) {
+	prefix := q.Get("prefix")
+	result := fakeListResult{Name: bucket, Prefix: prefix}
+
+	self.mu.Lock()
+	for k, obj := range self.objects {
+		b, key, _ := strings.Cut(k, "/")
+		if b != bucket || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		class := obj.StorageClass
+		if class == "" {
+			class = "STANDARD"
+		}
+		result.Contents = append(result.Contents, fakeListEntry{
+			Key:          key,
+			Size:         int64(len(obj.Body)),
+			ETag:         obj.ETag(),
+			LastModified: obj.Modified.UTC().Format(time.RFC3339),
+			StorageClass: class,
+		})
+	}
+	self.mu.Unlock()
+
+	slices.SortFunc(result.Contents, func(a, b fakeListEntry) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	result.KeyCount = len(result.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(&result)
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/cobra"
+)
+
+const (
+	feedEnv           = "DBCOPY_RELEASE_FEED"
+	selfupdateTimeout = 30 * time.Second
+	feedMaxSize       = 1 << 20
+)
+
+var (
+	selfupdateCmd = cobra.Command{
+		Use:   "selfupdate-check [--feed url] [--download file]",
+		Short: "Check whether a newer version is available",
+		Long: `Check whether a newer version is available.
+
+The release feed is a JSON object like {"version": "v1.2.3", "url": "..."},
+at https:// or s3://bucket/key URL. By default it's from ` + feedEnv + ` env.`,
+		Args:                  cobra.NoArgs,
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := loadEnvs(); err != nil {
+				return err
+			} else if selfupdateFeed == "" {
+				selfupdateFeed = os.Getenv(feedEnv)
+			}
+
+			if selfupdateFeed == "" {
+				return fmt.Errorf("release feed not configured, use --feed or %s env",
+					feedEnv)
+			}
+
+			ctx, cancel := commandContext(selfupdateTimeout)
+			defer cancel()
+			return SelfupdateCheck(ctx, newFeedReader(), rootCmd.Version,
+				selfupdateFeed, selfupdateDownload)
+		},
+	}
+
+	selfupdateFeed     string
+	selfupdateDownload string
+)
+
+func init() {
+	selfupdateCmd.Flags().StringVar(&selfupdateFeed, "feed", "",
+		"URL of release feed, https:// or s3://bucket/key (env "+feedEnv+")")
+	selfupdateCmd.Flags().StringVar(&selfupdateDownload, "download", "",
+		"download newer version into this new file")
+}
+
+// releaseFeed describes the latest release.
+type releaseFeed struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+}
+
+// SelfupdateCheck reads release feed by r and prints whether it has newer
+// version than current. If it does and fname isn't empty, it downloads the
+// release into new file fname.
+func SelfupdateCheck(ctx context.Context, r *feedReader,
+	current, feedURL, fname string,
+) error {
+	if current == "" {
+		return errors.New("unknown current version")
+	}
+
+	var feed releaseFeed
+	err := r.Read(ctx, feedURL, func(r io.Reader) error {
+		err := json.NewDecoder(io.LimitReader(r, feedMaxSize)).Decode(&feed)
+		if err != nil {
+			return fmt.Errorf("decode json: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("read release feed %q: %w", feedURL, err)
+	} else if feed.Version == "" {
+		return fmt.Errorf("release feed %q: no version", feedURL)
+	}
+
+	if compareVersions(feed.Version, current) <= 0 {
+		fmt.Println("up to date:", current)
+		return nil
+	}
+	fmt.Println("newer version available:", feed.Version, "current:", current)
+
+	if fname == "" {
+		return nil
+	} else if feed.URL == "" {
+		return fmt.Errorf("release feed %q: no url", feedURL)
+	}
+	return downloadRelease(ctx, r, feed.URL, fname)
+}
+
+func downloadRelease(ctx context.Context, r *feedReader, from, fname string,
+) error {
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o755)
+	if err != nil {
+		return fmt.Errorf("create %q: %w", fname, err)
+	}
+	defer f.Close()
+
+	log.Println("download", from, "into", fname)
+	err = r.Read(ctx, from, func(r io.Reader) error {
+		if _, err := io.Copy(f, r); err != nil {
+			return fmt.Errorf("copy: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = os.Remove(fname)
+		return fmt.Errorf("download %q: %w", from, err)
+	} else if err := f.Close(); err != nil {
+		return fmt.Errorf("close %q: %w", fname, err)
+	}
+	return nil
+}
+
+// newFeedReader returns feedReader, which creates S3 client by newFeedClient.
+func newFeedReader() *feedReader {
+	return &feedReader{newClient: newFeedClient}
+}
+
+// feedReader reads release feed and releases. It creates S3 client on the
+// first s3:// URL, so https:// feeds don't need AWS configuration.
+type feedReader struct {
+	client    *s3.Client
+	newClient func(ctx context.Context) (*s3.Client, error)
+}
+
+// newFeedClient returns S3 client, configured by the same flags as root
+// client. Unlike rootSetup, it doesn't change any globals, so it doesn't
+// depend on --bucket and doesn't reopen the log.
+func newFeedClient(ctx context.Context) (*s3.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, configOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("aws config: %w", err)
+	} else if noSignRequest {
+		cfg.APIOptions = append(cfg.APIOptions, removeSigning)
+	}
+	return s3.NewFromConfig(cfg), nil
+}
+
+// Read calls fn with body of https:// or s3:// rawURL.
+func (self *feedReader) Read(ctx context.Context, rawURL string,
+	fn func(r io.Reader) error,
+) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("parse url: %w", err)
+	}
+
+	var body io.ReadCloser
+	switch u.Scheme {
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return fmt.Errorf("new request: %w", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("get: %w", err)
+		} else if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("get: unexpected status %q", resp.Status)
+		}
+		body = resp.Body
+	case "s3":
+		if self.client == nil {
+			client, err := self.newClient(ctx)
+			if err != nil {
+				return err
+			}
+			self.client = client
+		}
+		client, err := bucketClient(ctx, self.client, u.Host)
+		if err != nil {
+			return err
+		}
+		key := strings.TrimPrefix(u.Path, "/")
+		resp, err := client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(u.Host),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("read %q: %w", key, err)
+		}
+		body = resp.Body
+	default:
+		return fmt.Errorf("unexpected url scheme %q", u.Scheme)
+	}
+	defer body.Close()
+	return fn(body)
+}
+
+// compareVersions compares versions like v1.2.3 numerically and returns -1, 0
+// or +1. Any pre-release or build suffix is ignored.
+func compareVersions(a, b string) int {
+	as, bs := versionParts(a), versionParts(b)
+	for i := range max(len(as), len(bs)) {
+		var x, y int
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+
+	fields := strings.Split(v, ".")
+	parts := make([]int, len(fields))
+	for i, s := range fields {
+		parts[i], _ = strconv.Atoi(s)
+	}
+	return parts
+}
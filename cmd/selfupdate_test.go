@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "v1.2.3", b: "v1.2.3", want: 0},
+		{a: "1.2.3", b: "v1.2.3", want: 0},
+		{a: "v1.2.3", b: "v1.2.4", want: -1},
+		{a: "v1.10.0", b: "v1.9.0", want: 1},
+		{a: "v2.0.0", b: "v1.99.99", want: 1},
+		{a: "v1.2", b: "v1.2.0", want: 0},
+		{a: "v1.2", b: "v1.2.1", want: -1},
+		{a: "v1.2.3-rc1", b: "v1.2.3", want: 0},
+		{a: "v1.2.3+build", b: "v1.2.4", want: -1},
+		{a: " v1.0.0 ", b: "v1.0.0", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			if got := compareVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got,
+					tt.want)
+			}
+		})
+	}
+}
+
+func TestSelfupdateCheck_s3(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  string
+		wantFile bool
+	}{
+		{name: "newer", current: "v1.0.0", wantFile: true},
+		{name: "up to date", current: "v2.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("feeds", "dbcopy.json",
+				[]byte(`{"version": "v2.0.0", "url": "s3://releases/dbcopy"}`))
+			fake.Put("releases", "dbcopy", []byte("release"))
+
+			var newClients int
+			r := &feedReader{newClient: func(context.Context) (*s3.Client, error) {
+				newClients++
+				return fake.Client(), nil
+			}}
+			fname := filepath.Join(t.TempDir(), "dbcopy")
+			err := SelfupdateCheck(context.Background(), r, tt.current,
+				"s3://feeds/dbcopy.json", fname)
+			if err != nil {
+				t.Fatalf("SelfupdateCheck(): %v", err)
+			} else if newClients != 1 {
+				t.Errorf("%d clients created, want 1", newClients)
+			}
+
+			b, err := os.ReadFile(fname)
+			if !tt.wantFile {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("release downloaded: %v", err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			} else if string(b) != "release" {
+				t.Errorf("release = %q, want %q", b, "release")
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/spf13/cobra"
+)
+
+const transitionTimeout = time.Hour
+
+var (
+	transitionCmd = cobra.Command{
+		Use:   "transition -b my-bucket -c class [-r] [--dry-run] name...",
+		Short: "Change storage class of name.bz2.crypt",
+		Long: `Change storage class of name.bz2.crypt, copying the object into itself.
+
+With -r every name is a key prefix and all objects under it are transitioned.`,
+		Args:                  cobra.MinimumNArgs(1),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			class := types.StorageClass(transitionClass)
+			if !slices.Contains(class.Values(), class) {
+				return fmt.Errorf("unknown storage class %q, expected one of %v",
+					transitionClass, class.Values())
+			} else if err := rootSetup(); err != nil {
+				return err
+			}
+
+			ctx, cancel := commandContext(transitionTimeout)
+			defer cancel()
+
+			t := NewTransition(s3Client, s3Bucket, class).
+				WithDryRun(transitionDryRun)
+			for _, name := range args {
+				if err := t.Run(ctx, objectName(name),
+					transitionRecursive); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	transitionClass     string
+	transitionDryRun    bool
+	transitionRecursive bool
+)
+
+func init() {
+	transitionCmd.Flags().StringVarP(&transitionClass, "storage-class", "c",
+		string(types.StorageClassGlacier),
+		"new storage class, like GLACIER, DEEP_ARCHIVE or STANDARD_IA")
+	transitionCmd.Flags().BoolVar(&transitionDryRun, "dry-run", false,
+		"only print what would be transitioned")
+	transitionCmd.Flags().BoolVarP(&transitionRecursive, "recursive", "r",
+		false, "transition all objects with name prefix")
+}
+
+func NewTransition(client *s3.Client, bucket string, class types.StorageClass,
+) *Transition {
+	return &Transition{client: client, bucket: bucket, class: class}
+}
+
+type Transition struct {
+	client *s3.Client
+	bucket string
+	class  types.StorageClass
+	dryRun bool
+}
+
+func (self *Transition) WithDryRun(v bool) *Transition {
+	self.dryRun = v
+	return self
+}
+
+func (self *Transition) Run(ctx context.Context, name string, recursive bool,
+) error {
+	if !recursive {
+		return self.transition(ctx, name+sqlExt)
+	}
+
+	pager := s3.NewListObjectsV2Paginator(self.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(self.bucket),
+		Prefix: aws.String(name),
+	})
+
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("list %q: %w", name, err)
+		}
+		for i := range page.Contents {
+			obj := &page.Contents[i]
+			if types.StorageClass(obj.StorageClass) == self.class {
+				continue
+			} else if err := self.transition(ctx, aws.ToString(obj.Key)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (self *Transition) transition(ctx context.Context, key string) error {
+	h, err := self.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(self.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("heading %q: %w", key, err)
+	}
+
+	// HeadObject doesn't return storage class of STANDARD objects.
+	class := types.StorageClass(h.StorageClass)
+	if class == "" {
+		class = types.StorageClassStandard
+	}
+	if class == self.class {
+		log.Println(key, "is already", self.class)
+		return nil
+	} else if self.dryRun {
+		log.Println("would transition", key, "to", self.class)
+		return nil
+	}
+
+	log.Println("transition", key, "to", self.class)
+	source := url.PathEscape(self.bucket + "/" + key)
+	if aws.ToInt64(h.ContentLength) > maxCopySize {
+		err = copyMultipart(ctx, self.client, self.bucket, key, source, h,
+			self.class)
+	} else {
+		_, err = self.client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:            aws.String(self.bucket),
+			Key:               aws.String(key),
+			CopySource:        aws.String(source),
+			MetadataDirective: types.MetadataDirectiveCopy,
+			StorageClass:      self.class,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("transition %q to %v: %w", key, self.class, err)
+	}
+	return nil
+}
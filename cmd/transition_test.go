@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestTransition_Run(t *testing.T) {
+	tests := []struct {
+		name      string
+		dryRun    bool
+		wantClass string
+	}{
+		{name: "transition", wantClass: "GLACIER"},
+		{name: "dry run", dryRun: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "db/foo"+sqlExt, []byte("content"))
+			fake.store("bucket", "db/foo"+okExt, &fakeObject{
+				StorageClass: "GLACIER",
+			})
+
+			err := NewTransition(fake.Client(), "bucket",
+				types.StorageClassGlacier).WithDryRun(tt.dryRun).
+				Run(context.Background(), "db/", true)
+			if err != nil {
+				t.Fatalf("Run(): %v", err)
+			}
+
+			obj, _ := fake.Get("bucket", "db/foo"+sqlExt)
+			if obj.StorageClass != tt.wantClass {
+				t.Errorf("storage class %q, want %q", obj.StorageClass,
+					tt.wantClass)
+			} else if string(obj.Body) != "content" {
+				t.Errorf("transitioned content %q, want %q", obj.Body, "content")
+			}
+
+			// Objects already in the class are skipped without copying.
+			copied := slices.ContainsFunc(fake.Requests(), func(s string) bool {
+				return strings.HasPrefix(s, "PUT /bucket/db/foo"+okExt)
+			})
+			if copied {
+				t.Errorf("%q copied, but it's already GLACIER", "db/foo"+okExt)
+			}
+		})
+	}
+}
+
+func TestCopyMultipart(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+	client := fake.Client()
+
+	ctx := context.Background()
+	h, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("foo" + sqlExt),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := url.PathEscape("bucket/foo" + sqlExt)
+	err = copyMultipart(ctx, client, "dest", "foo"+sqlExt, source, h,
+		types.StorageClassGlacier)
+	if err != nil {
+		t.Fatalf("copyMultipart(): %v", err)
+	}
+
+	if obj, ok := fake.Get("dest", "foo"+sqlExt); !ok {
+		t.Fatal("object isn't copied")
+	} else if string(obj.Body) != "content" {
+		t.Errorf("copied content %q, want %q", obj.Body, "content")
+	} else if !slices.Equal(obj.PartSizes, []int{len("content")}) {
+		t.Errorf("copied parts %v, want single part", obj.PartSizes)
+	}
+}
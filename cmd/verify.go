@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/cobra"
+)
+
+const (
+	manifestExt   = ".sha256sums"
+	verifyTimeout = 12 * time.Hour
+)
+
+var (
+	verifyCmd = cobra.Command{
+		Use:                   "verify -b my-bucket [-m manifest] [-c concurrency] name",
+		Short:                 "Verify parts of name against name.sha256sums",
+		Args:                  cobra.ExactArgs(1),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := rootSetup(); err != nil {
+				return err
+			}
+
+			ctx, cancel := commandContext(verifyTimeout)
+			defer cancel()
+
+			name := objectName(args[0])
+			manifest := name + manifestExt
+			if verifyManifest != "" {
+				manifest = objectName(verifyManifest)
+			}
+			return NewVerify(s3Client, s3Bucket).
+				WithConcurrency(verifyConcurrency).
+				Run(ctx, manifest)
+		},
+	}
+
+	verifyManifest    string
+	verifyConcurrency int
+)
+
+func init() {
+	verifyCmd.Flags().StringVarP(&verifyManifest, "checksum-manifest", "m", "",
+		"key of manifest in sha256sum format (default name.sha256sums)")
+	verifyCmd.Flags().IntVarP(&verifyConcurrency, "concurrency", "c", 1,
+		"verify this many parts concurrently")
+}
+
+func NewVerify(client *s3.Client, bucket string) *Verify {
+	return &Verify{client: client, bucket: bucket, concurrency: 1}
+}
+
+type Verify struct {
+	client      *s3.Client
+	bucket      string
+	concurrency int
+}
+
+// manifestEntry is a part listed in manifest. Size is -1, if manifest doesn't
+// have it.
+type manifestEntry struct {
+	Key    string
+	SHA256 string
+	Size   int64
+}
+
+func (self *Verify) WithConcurrency(n int) *Verify {
+	self.concurrency = max(n, 1)
+	return self
+}
+
+// Run reads manifest, downloads every part listed in it and compares its
+// SHA-256 with the manifest. Part names are relative to the manifest key.
+func (self *Verify) Run(ctx context.Context, manifest string) error {
+	entries, err := readManifest(ctx, self.client, self.bucket, manifest)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(entries))
+	sem := make(chan struct{}, self.concurrency)
+	var wg sync.WaitGroup
+	for i := range entries {
+		entry := &entries[i]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := self.verify(ctx, entry); err != nil {
+				log.Printf("✗ %s: %v", entry.Key, err)
+				errs[i] = err
+				return
+			}
+			log.Printf("✓ %s", entry.Key)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// readManifest reads manifest key in sha256sum format. Every line can also
+// have size of the part between checksum and file name, separated by single
+// spaces, like
+//
+//	sum 1234 fname
+func readManifest(ctx context.Context, client *s3.Client, bucket, key string,
+) ([]manifestEntry, error) {
+	resp, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %w", key, err)
+	}
+	defer resp.Body.Close()
+	return parseManifest(key, resp.Body)
+}
+
+// parseManifest parses manifest key from r. Keys of parts are relative to
+// directory of key.
+func parseManifest(key string, r io.Reader) ([]manifestEntry, error) {
+	dir := path.Dir(key)
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		sum, fname, ok := strings.Cut(line, " ")
+		if !ok || len(sum) != sha256.Size*2 {
+			return nil, fmt.Errorf("%q line %v: unexpected format: %q", key, n,
+				line)
+		}
+
+		size := int64(-1)
+		// sha256sum(1) puts ' ' or '*' before file name, so a digit is a size.
+		if fname != "" && fname[0] >= '0' && fname[0] <= '9' {
+			s, rest, _ := strings.Cut(fname, " ")
+			v, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || rest == "" {
+				return nil, fmt.Errorf("%q line %v: unexpected format: %q", key, n,
+					line)
+			}
+			size, fname = v, rest
+		}
+
+		// sha256sum(1) marks binary mode by '*' before file name.
+		fname = strings.TrimPrefix(strings.TrimLeft(fname, " "), "*")
+		entries = append(entries, manifestEntry{
+			Key:    path.Join(dir, fname),
+			SHA256: strings.ToLower(sum),
+			Size:   size,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %q: %w", key, err)
+	} else if len(entries) == 0 {
+		return nil, fmt.Errorf("empty manifest %q", key)
+	}
+	return entries, nil
+}
+
+func (self *Verify) verify(ctx context.Context, entry *manifestEntry) error {
+	resp, err := self.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(self.bucket),
+		Key:    aws.String(entry.Key),
+	})
+	if err != nil {
+		return fmt.Errorf("read %q: %w", entry.Key, err)
+	}
+	defer resp.Body.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, resp.Body)
+	if err != nil {
+		return fmt.Errorf("read %q: %w", entry.Key, err)
+	}
+	return entry.Check(n, h.Sum(nil))
+}
+
+// Check returns an error, if size or sum doesn't match the entry.
+func (self *manifestEntry) Check(size int64, sum []byte) error {
+	if self.Size >= 0 && size != self.Size {
+		return fmt.Errorf("size mismatch of %q: expected %v, got %v",
+			self.Key, self.Size, size)
+	} else if s := hex.EncodeToString(sum); s != self.SHA256 {
+		return fmt.Errorf("checksum mismatch of %q: expected %v, got %v",
+			self.Key, self.SHA256, s)
+	}
+	return nil
+}
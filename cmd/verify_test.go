@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	const (
+		sum1 = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+		sum2 = "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+	)
+
+	tests := []struct {
+		name    string
+		content string
+		want    []manifestEntry
+		wantErr bool
+	}{
+		{
+			name:    "sha256sum text mode",
+			content: sum1 + "  foo.part1\n" + sum2 + "  foo.part2\n",
+			want: []manifestEntry{
+				{Key: "db/foo.part1", SHA256: sum1, Size: -1},
+				{Key: "db/foo.part2", SHA256: sum2, Size: -1},
+			},
+		},
+		{
+			name:    "sha256sum binary mode",
+			content: sum1 + " *foo.part1\n",
+			want:    []manifestEntry{{Key: "db/foo.part1", SHA256: sum1, Size: -1}},
+		},
+		{
+			name:    "with size",
+			content: sum1 + " 1024 foo.part1\n",
+			want:    []manifestEntry{{Key: "db/foo.part1", SHA256: sum1, Size: 1024}},
+		},
+		{
+			name:    "upper case and empty lines",
+			content: "\n" + strings.ToUpper(sum1) + "  foo.part1\n\n",
+			want:    []manifestEntry{{Key: "db/foo.part1", SHA256: sum1, Size: -1}},
+		},
+		{name: "empty", content: "\n", wantErr: true},
+		{name: "short sum", content: "0123  foo.part1\n", wantErr: true},
+		{name: "no name", content: sum1 + "\n", wantErr: true},
+		{name: "size without name", content: sum1 + " 1024\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseManifest("db/foo"+manifestExt,
+				strings.NewReader(tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseManifest() = %v, want error", got)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("parseManifest(): %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseManifest() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVerify_Run(t *testing.T) {
+	tests := []struct {
+		name    string
+		bad     int
+		wantErr string
+	}{
+		{name: "ok", bad: -1},
+		{name: "first", bad: 0, wantErr: "db/foo.part1"},
+		{name: "second", bad: 1, wantErr: "db/foo.part2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			manifest := putManifest(fake, tt.bad, "first", "second")
+
+			err := NewVerify(fake.Client(), "bucket").WithConcurrency(2).
+				Run(context.Background(), manifest)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Run(): %v", err)
+				}
+				return
+			} else if err == nil {
+				t.Fatal("Run() = nil, want error")
+			}
+
+			msg := err.Error()
+			if !strings.Contains(msg, "checksum mismatch of "+`"`+tt.wantErr) {
+				t.Errorf("Run() = %v, want mismatch of %s", err, tt.wantErr)
+			} else if strings.Count(msg, "mismatch") != 1 {
+				t.Errorf("Run() = %v, want single mismatch", err)
+			}
+		})
+	}
+}
@@ -6,17 +6,20 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"net/http"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/charmbracelet/bubbles/progress"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/muesli/termenv"
 	"github.com/spf13/cobra"
 )
 
@@ -28,32 +31,106 @@ const (
 
 	barPad      = 8
 	barMaxWidth = 64
+
+	errSnippetLen = 256
+
+	defaultMaxErrorBytes = 64 << 10
+
+	defaultPendingLabel = "pending (no marker yet)"
+	runningLabel        = "running (started, awaiting ok)"
+
+	minTickInterval = 100 * time.Millisecond
+	maxTickInterval = time.Minute
+
+	bellOk    = "ok"
+	bellError = "error"
+	bellBoth  = "both"
 )
 
 var (
 	waitCmd = cobra.Command{
-		Use:                   "wait -b my-bucket [-t timeout] name",
+		Use:                   "wait -b my-bucket [-t timeout] [--first-ok] name...",
 		Short:                 "Wait for name.bz2.crypt",
-		Args:                  cobra.ExactArgs(1),
+		Args:                  cobra.MinimumNArgs(1),
 		DisableFlagsInUseLine: true,
 
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := rootSetup(); err != nil {
 				return err
 			}
-			return Wait(args[0])
+			objects := make([]string, len(args))
+			for i, name := range args {
+				if waitCrossBucket {
+					objects[i] = name
+				} else {
+					objects[i] = objectName(name)
+				}
+			}
+			return Wait(objects...)
 		},
 	}
 
-	waitMax time.Duration
+	waitMax     time.Duration
+	waitUntil   string
+	waitHooks   WaitHooks
+	waitFirstOk bool
+	waitData    bool
+	waitPollVia string
+	waitAll     bool
+	waitFail    = true
+	allowEmpty  bool
+
+	waitConcurrentMarkers bool
+	waitDataKey           string
+
+	waitBell   bool
+	waitBellOn = bellBoth
+
+	waitTickInterval   = time.Second
+	waitSummaryFile    string
+	waitCrossBucket    bool
+	waitMaxActive      int
+	waitMaxErrBytes    string
+	waitPollBackoff    time.Duration
+	waitShowMeta       []string
+	waitGroup          bool
+	waitPendingLabel   = defaultPendingLabel
+	waitRetryTransient bool
 )
 
 type waitMsg struct {
+	item    *waitItem
 	started bool
 	size    int64
+	meta    string
 	err     error
 }
 
+// waitItem is the state of one object WaitModel waits for.
+type waitItem struct {
+	client  *s3.Client
+	bucket  string
+	name    string
+	dataKey string
+	size    int64
+	done    bool
+	ok      bool
+	err     error
+
+	startedAt  time.Time
+	finishedAt time.Time
+	active     bool
+
+	running context.Context
+	cancel  context.CancelFunc
+}
+
+func (self *waitItem) Done() {
+	self.done = true
+	self.finishedAt = time.Now()
+	self.cancel()
+}
+
 func tickCmd(d time.Duration) tea.Cmd {
 	return tea.Tick(d, func(t time.Time) tea.Msg {
 		return tickMsg(t)
@@ -62,40 +139,318 @@ func tickCmd(d time.Duration) tea.Cmd {
 
 type tickMsg time.Time
 
+// WaitStatus is a status transition of object WaitModel waits for.
+type WaitStatus int
+
+const (
+	WaitStarted WaitStatus = iota + 1
+	WaitOk
+	WaitError
+)
+
+func (self WaitStatus) String() string {
+	switch self {
+	case WaitStarted:
+		return "started"
+	case WaitOk:
+		return "ok"
+	case WaitError:
+		return "error"
+	}
+	return fmt.Sprintf("WaitStatus(%d)", int(self))
+}
+
+// WaitEvent is delivered to WaitModel.WithNotify callback.
+type WaitEvent struct {
+	Name   string
+	Status WaitStatus
+	Size   int64 // Size of data object for WaitOk.
+	Err    error // Error for WaitError.
+}
+
 func init() {
 	waitCmd.Flags().DurationVarP(&waitMax, "timeout", "t", 30*time.Minute,
 		"wait timeout")
+	waitCmd.Flags().StringVar(&waitUntil, "deadline", "",
+		"wait until RFC3339 time, like 2006-01-02T06:00:00+03:00")
+	waitCmd.Flags().StringVar(&waitHooks.OnStarted, "on-started", "",
+		"run shell command, when name.started appears")
+	waitCmd.Flags().StringVar(&waitHooks.OnOk, "on-ok", "",
+		"run shell command, when name.ok appears")
+	waitCmd.Flags().StringVar(&waitHooks.OnError, "on-error", "",
+		"run shell command, when wait failed")
+	waitCmd.Flags().BoolVar(&waitHooks.Strict, "strict-hooks", false,
+		"fail if any hook failed")
+	waitCmd.Flags().BoolVar(&waitFirstOk, "first-ok", false,
+		"wait for the first ok of multiple names, instead of all of them")
+	waitCmd.Flags().BoolVar(&waitData, "wait-data", false,
+		"wait for name.bz2.crypt itself, instead of markers")
+	waitCmd.Flags().StringVar(&waitPollVia, "poll-via", pollViaHead,
+		"check objects using HeadObject (head) or ListObjectsV2 (list)")
+	waitCmd.Flags().BoolVar(&waitFail, "fail-fast", waitFail,
+		"stop waiting for all names on the first error, false is --wait-all")
+	waitCmd.Flags().BoolVar(&waitAll, "wait-all", false,
+		"wait for all names, even if some of them failed")
+	waitCmd.MarkFlagsMutuallyExclusive("fail-fast", "wait-all")
+	waitCmd.Flags().BoolVar(&allowEmpty, "allow-empty", false,
+		"accept empty name.bz2.crypt")
+	waitCmd.Flags().BoolVar(&waitConcurrentMarkers, "concurrent-markers", false,
+		"check markers of all names by shared ListObjectsV2 of their common prefix")
+	waitCmd.Flags().StringVar(&waitDataKey, "data-key", "",
+		"key of data object, if it isn't name.bz2.crypt")
+	waitCmd.Flags().BoolVar(&waitBell, "bell", false,
+		"ring terminal bell, when wait completed")
+	waitCmd.Flags().StringVar(&waitBellOn, "bell-on", waitBellOn,
+		"ring --bell on: ok, error or both")
+	waitCmd.Flags().DurationVar(&waitTickInterval, "progress-interval",
+		waitTickInterval, fmt.Sprintf("refresh progress bar this often (%v - %v)",
+			minTickInterval, maxTickInterval))
+	waitCmd.Flags().StringVar(&waitSummaryFile, "json-summary-file", "",
+		"write final JSON summary into this file")
+	waitCmd.Flags().BoolVar(&waitCrossBucket, "cross-bucket", false,
+		"every name is bucket/name, so names can be in different buckets")
+	waitCmd.Flags().IntVar(&waitMaxActive, "max-concurrent-waits", 0,
+		"wait for up to this many names concurrently and queue the rest")
+	waitCmd.Flags().StringVar(&waitMaxErrBytes, "max-error-bytes", "64KiB",
+		"read up to this size of name.error and truncate the rest")
+	waitCmd.Flags().DurationVar(&waitPollBackoff, "interval-backoff",
+		listMaxDelay, "grow delay between polls up to this, the longer we wait")
+	waitCmd.Flags().StringSliceVar(&waitShowMeta, "show-meta", nil,
+		"print these keys of metadata of name.bz2.crypt, like rows,db")
+	waitCmd.Flags().BoolVar(&waitGroup, "group", false,
+		"every name is a group of objects with name prefix and single name.ok")
+	waitCmd.Flags().StringVar(&waitPendingLabel, "pending-label",
+		waitPendingLabel, "show this, while name.started hasn't appeared yet")
+	waitCmd.Flags().BoolVar(&waitRetryTransient,
+		"retry-transient-errors-as-pending", false,
+		"retry timeouts and 5xx errors, like nothing appeared yet, until timeout")
+	waitCmd.MarkFlagsMutuallyExclusive("group", "wait-data")
+	waitCmd.MarkFlagsMutuallyExclusive("group", "data-key")
 }
 
-func Wait(object string) error {
-	termenv.SetDefaultOutput(termenv.NewOutput(os.Stderr))
-	lipgloss.SetDefaultRenderer(lipgloss.NewRenderer(os.Stderr))
+func Wait(objects ...string) error {
+	if waitPollVia != pollViaHead && waitPollVia != pollViaList {
+		return fmt.Errorf("unexpected --poll-via=%q, expected %q or %q",
+			waitPollVia, pollViaHead, pollViaList)
+	}
+
+	switch waitBellOn {
+	case bellOk, bellError, bellBoth:
+	default:
+		return fmt.Errorf("unexpected --bell-on=%q, expected %q, %q or %q",
+			waitBellOn, bellOk, bellError, bellBoth)
+	}
 
-	model := NewWaitModel(s3Client, s3Bucket, object).WithTimeout(waitMax)
+	if waitDataKey != "" && len(objects) > 1 {
+		return errors.New("--data-key can't be used with multiple names")
+	}
+
+	if !waitFail {
+		waitAll = true
+	}
+
+	maxErrBytes, err := parseBytes(waitMaxErrBytes)
+	if err != nil {
+		return fmt.Errorf("parse --max-error-bytes: %w", err)
+	}
+
+	var buckets []string
+	if waitCrossBucket {
+		if objects, buckets, err = splitBuckets(objects); err != nil {
+			return err
+		}
+	}
+
+	var deadline time.Time
+	if waitUntil != "" {
+		t, err := time.Parse(time.RFC3339, waitUntil)
+		if err != nil {
+			return fmt.Errorf("parse --deadline: %w", err)
+		} else if time.Until(t) <= 0 {
+			return fmt.Errorf("deadline %v already passed", waitUntil)
+		}
+		deadline = t
+	}
+
+	// WaitModel doesn't use commandContext, because it has own deadline.
+	if commandTimeout > 0 {
+		t := time.Now().Add(commandTimeout)
+		if deadline.IsZero() || t.Before(deadline) {
+			deadline = t
+		}
+	}
+
+	model := NewWaitModel(s3Client, s3Bucket, objects...).WithTimeout(waitMax).
+		WithDeadline(deadline).
+		WithHooks(waitHooks).WithFirstOk(waitFirstOk).WithWaitData(waitData).
+		WithPollViaList(waitPollVia == pollViaList).WithWaitAll(waitAll).
+		WithAllowEmpty(allowEmpty).WithConcurrentMarkers(waitConcurrentMarkers).
+		WithTickInterval(waitTickInterval).WithMaxActive(waitMaxActive).
+		WithMaxErrorBytes(maxErrBytes).WithIntervalBackoff(waitPollBackoff).
+		WithShowMeta(waitShowMeta).WithGroup(waitGroup).
+		WithPendingLabel(waitPendingLabel).
+		WithRetryTransient(waitRetryTransient)
+	if waitDataKey != "" {
+		model.WithDataKey(objectName(waitDataKey))
+	}
+	if err := withBuckets(model, buckets); err != nil {
+		return err
+	}
+
+	sock, err := listenProgress(progressSocketPath)
+	if err != nil {
+		return err
+	} else if sock != nil {
+		defer sock.Close()
+		model.WithNotify(func(ev WaitEvent) {
+			pe := progressEvent{
+				Event: ev.Status.String(),
+				Name:  ev.Name,
+				Size:  ev.Size,
+			}
+			if ev.Err != nil {
+				pe.Error = ev.Err.Error()
+			}
+			sock.Send(pe)
+		})
+	}
 	defer model.Wait()
-	progress := tea.NewProgram(model, tea.WithOutput(os.Stderr))
+
+	opts := []tea.ProgramOption{tea.WithOutput(os.Stderr)}
+	if quietSuccess {
+		opts = append(opts, tea.WithoutRenderer(), tea.WithInput(nil))
+		model.WithPlain(logWriter{}).WithWarnings(os.Stderr)
+	} else if dumbTerminal() {
+		opts = append(opts, tea.WithoutRenderer())
+		model.WithPlain(os.Stderr)
+	}
+	progress := tea.NewProgram(model, opts...)
 
 	if _, err := progress.Run(); err != nil {
 		return fmt.Errorf("tea program: %w", err)
 	}
 
-	err := context.Cause(model.running)
-	if err != nil && !errors.Is(err, context.Canceled) {
+	err = context.Cause(model.running)
+	failed := err != nil && !errors.Is(err, context.Canceled)
+	if waitSummaryFile != "" {
+		if err := model.WriteSummary(waitSummaryFile, err); err != nil {
+			return err
+		}
+	}
+	if waitBell {
+		ringBell(os.Stderr, waitBellOn, failed)
+	}
+
+	if failed {
 		return fmt.Errorf("canceled: %w", err)
+	} else if quietSuccess {
+		return nil
+	}
+
+	if len(model.items) == 1 {
+		fmt.Println(model.items[0].size)
+		return nil
 	}
 
-	fmt.Println(model.contentLength)
+	for _, item := range model.items {
+		if item.ok {
+			fmt.Println(model.itemName(item), item.size)
+		}
+	}
+	return nil
+}
+
+// splitBuckets splits every bucket/name of objects and returns names with
+// configured prefix and their buckets, in the same order. The same name can
+// be in multiple buckets.
+func splitBuckets(objects []string) ([]string, []string, error) {
+	names := make([]string, len(objects))
+	buckets := make([]string, len(objects))
+	for i, s := range objects {
+		bucket, name, ok := strings.Cut(s, "/")
+		if !ok || bucket == "" || name == "" {
+			return nil, nil, fmt.Errorf("expected bucket/name, got %q", s)
+		}
+		names[i], buckets[i] = objectName(name), bucket
+	}
+	return names, buckets, nil
+}
+
+// withBuckets configures model to wait for every object in its bucket from
+// buckets with the same index, with client configured for region of the
+// bucket.
+func withBuckets(model *WaitModel, buckets []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+	defer cancel()
+
+	clients := make(map[string]*s3.Client)
+	for i, bucket := range buckets {
+		client, ok := clients[bucket]
+		if !ok {
+			c, err := bucketClient(ctx, s3Client, bucket)
+			if err != nil {
+				return err
+			}
+			client, clients[bucket] = c, c
+		}
+		model.WithObjectBucket(i, client, bucket)
+	}
 	return nil
 }
 
+// dumbTerminal returns true, if TERM is dumb or isn't set, so the TUI can't be
+// rendered properly. Windows console has no TERM at all.
+func dumbTerminal() bool {
+	term := os.Getenv("TERM")
+	return term == "dumb" || (term == "" && runtime.GOOS != "windows")
+}
+
+// ringBell writes terminal bell into f, if f is a terminal and outcome of
+// wait matches on.
+func ringBell(f *os.File, on string, failed bool) {
+	if isTerminal(f) && bellMatches(on, failed) {
+		_, _ = io.WriteString(f, "\a")
+	}
+}
+
+// bellMatches returns true, if outcome of wait matches --bell-on.
+func bellMatches(on string, failed bool) bool {
+	switch on {
+	case bellOk:
+		return !failed
+	case bellError:
+		return failed
+	}
+	return true
+}
+
 // ==================================================
 
-func NewWaitModel(client *s3.Client, bucket string, object string) *WaitModel {
+func NewWaitModel(client *s3.Client, bucket string, objects ...string,
+) *WaitModel {
 	ctx, cancel := context.WithCancelCause(context.Background())
+	items := make([]*waitItem, len(objects))
+	for i, name := range objects {
+		itemCtx, itemCancel := context.WithCancel(ctx)
+		items[i] = &waitItem{
+			client:  client,
+			bucket:  bucket,
+			name:    name,
+			dataKey: name + sqlExt,
+			running: itemCtx,
+			cancel:  itemCancel,
+		}
+	}
+
 	return &WaitModel{
 		client: client,
 		bucket: bucket,
-		object: object,
+		items:  items,
+		tick:   time.Second,
+
+		maxErrorBytes: defaultMaxErrorBytes,
+		pollMaxDelay:  listMaxDelay,
+		pendingLabel:  defaultPendingLabel,
 
 		styles: newWaitStyles(lipgloss.DefaultRenderer()),
 		progress: progress.New(progress.WithoutPercentage(),
@@ -107,13 +462,39 @@ func NewWaitModel(client *s3.Client, bucket string, object string) *WaitModel {
 }
 
 type WaitModel struct {
-	client  *s3.Client
-	bucket  string
-	object  string
-	waitMax time.Duration
+	client   *s3.Client
+	bucket   string
+	items    []*waitItem
+	waitMax  time.Duration
+	waitTill time.Time
+	hooks    WaitHooks
+	firstOk  bool
+	data     bool
+	pollList bool
+	waitAll  bool
+
+	allowEmpty bool
+	tick       time.Duration
+	notify     func(WaitEvent)
+	maxActive  int
+	queue      []*waitItem
+
+	maxErrorBytes int64
+	plain         io.Writer
+	warnings      io.Writer
+	group         bool
+	pollMaxDelay  time.Duration
+	showMeta      []string
+	pendingLabel  string
+
+	retryTransient bool
+
+	concurrentMarkers bool
+	lister            *prefixLister
 
 	wg        sync.WaitGroup
 	startedAt time.Time
+	deadline  time.Time
 	b         strings.Builder
 
 	styles   waitStyles
@@ -122,8 +503,6 @@ type WaitModel struct {
 
 	running context.Context
 	cancel  context.CancelCauseFunc
-
-	contentLength int64
 }
 
 // ==================================================
@@ -134,7 +513,9 @@ func newWaitStyles(r *lipgloss.Renderer) waitStyles {
 		green: s.Foreground(lipgloss.Color("2")),
 		help: s.SetString("Press Esc/C-c/q to quit").Foreground(
 			lipgloss.Color("#626262")),
+		red:   s.Foreground(lipgloss.Color("1")),
 		since: s.Width(barPad).Padding(0, 1).AlignHorizontal(lipgloss.Right),
+		warn:  s.Foreground(lipgloss.Color("3")),
 	}
 	return styles
 }
@@ -142,7 +523,9 @@ func newWaitStyles(r *lipgloss.Renderer) waitStyles {
 type waitStyles struct {
 	green lipgloss.Style
 	help  lipgloss.Style
+	red   lipgloss.Style
 	since lipgloss.Style
+	warn  lipgloss.Style
 }
 
 func (self *waitStyles) Green(s ...string) string {
@@ -153,10 +536,18 @@ func (self *waitStyles) Help(s ...string) string {
 	return self.help.Render(s...)
 }
 
+func (self *waitStyles) Red(s ...string) string {
+	return self.red.Render(s...)
+}
+
 func (self *waitStyles) Since(s ...string) string {
 	return self.since.Render(s...)
 }
 
+func (self *waitStyles) Warn(s ...string) string {
+	return self.warn.Render(s...)
+}
+
 // ==================================================
 
 func (self *WaitModel) WithTimeout(d time.Duration) *WaitModel {
@@ -164,6 +555,140 @@ func (self *WaitModel) WithTimeout(d time.Duration) *WaitModel {
 	return self
 }
 
+// WithDeadline configures absolute time, when WaitModel stops waiting. If
+// it's earlier than configured timeout, it wins.
+func (self *WaitModel) WithDeadline(t time.Time) *WaitModel {
+	self.waitTill = t
+	return self
+}
+
+// WithDataKey configures key of data object, if it isn't the marker name with
+// .bz2.crypt extension. It's for single object only.
+func (self *WaitModel) WithDataKey(key string) *WaitModel {
+	for _, item := range self.items {
+		item.dataKey = key
+	}
+	return self
+}
+
+// WithFirstOk configures WaitModel to finish, when the first of its objects
+// is ok, instead of waiting for all of them. Errors of other objects aren't
+// fatal, until all of them failed.
+func (self *WaitModel) WithFirstOk(v bool) *WaitModel {
+	self.firstOk = v
+	return self
+}
+
+// WithWaitData configures WaitModel to wait for data object itself, instead
+// of markers, for producers which don't write markers at all.
+func (self *WaitModel) WithWaitData(v bool) *WaitModel {
+	self.data = v
+	return self
+}
+
+// WithWaitAll configures WaitModel to wait for outcomes of all objects, even
+// if some of them failed, and return combined error after that. By default
+// it stops on the first error.
+func (self *WaitModel) WithWaitAll(v bool) *WaitModel {
+	self.waitAll = v
+	return self
+}
+
+// WithAllowEmpty configures WaitModel to accept empty data objects. By
+// default it's an error, because it's usually a failed producer.
+func (self *WaitModel) WithAllowEmpty(v bool) *WaitModel {
+	self.allowEmpty = v
+	return self
+}
+
+// WithTickInterval configures how often WaitModel refreshes its progress bar.
+// It's clamped to [minTickInterval, maxTickInterval].
+func (self *WaitModel) WithTickInterval(d time.Duration) *WaitModel {
+	self.tick = min(max(d, minTickInterval), maxTickInterval)
+	return self
+}
+
+// WithObjectBucket configures WaitModel to wait for i-th object in bucket,
+// instead of the default one. The client must be configured for region of
+// bucket.
+func (self *WaitModel) WithObjectBucket(i int, client *s3.Client,
+	bucket string,
+) *WaitModel {
+	item := self.items[i]
+	item.client, item.bucket = client, bucket
+	return self
+}
+
+// WithMaxActive configures WaitModel to wait for up to n objects
+// concurrently and queue the rest of them, so many objects don't exhaust
+// connections and API budget. Zero means no limit.
+func (self *WaitModel) WithMaxActive(n int) *WaitModel {
+	self.maxActive = max(n, 0)
+	return self
+}
+
+// WithMaxErrorBytes configures WaitModel to read up to n bytes of name.error
+// and truncate the rest of it.
+func (self *WaitModel) WithMaxErrorBytes(n int64) *WaitModel {
+	self.maxErrorBytes = max(n, 1)
+	return self
+}
+
+// WithIntervalBackoff configures WaitModel to grow delay between polls up to
+// d, the longer it waits. By default it grows up to 2 minutes, like
+// s3.ObjectExistsWaiter does. Long waits can use longer delays to reduce
+// number of requests.
+func (self *WaitModel) WithIntervalBackoff(d time.Duration) *WaitModel {
+	if d > 0 {
+		self.pollMaxDelay = max(d, listMinDelay)
+	}
+	return self
+}
+
+// WithShowMeta configures WaitModel to print keys of user metadata of data
+// object in ok line. Keys can be with or without x-amz-meta- prefix.
+func (self *WaitModel) WithShowMeta(keys []string) *WaitModel {
+	self.showMeta = make([]string, len(keys))
+	for i, k := range keys {
+		// The SDK returns metadata keys in lower case without prefix.
+		self.showMeta[i] = strings.TrimPrefix(strings.ToLower(k), "x-amz-meta-")
+	}
+	return self
+}
+
+// WithPlain configures WaitModel to print its lines into w by itself, because
+// the program has no renderer, which prints them.
+func (self *WaitModel) WithPlain(w io.Writer) *WaitModel {
+	self.plain = w
+	return self
+}
+
+// println prints line above the TUI, or into plain output without it.
+func (self *WaitModel) println(args ...any) tea.Cmd {
+	if self.plain == nil {
+		return tea.Println(args...)
+	}
+	return func() tea.Msg {
+		fmt.Fprintln(self.plain, fmt.Sprint(args...))
+		return nil
+	}
+}
+
+// WithPendingLabel configures the status WaitModel shows, while marker
+// .started of an object hasn't appeared yet.
+func (self *WaitModel) WithPendingLabel(s string) *WaitModel {
+	self.pendingLabel = s
+	return self
+}
+
+// WithNotify configures WaitModel to call fn on every status transition of
+// its objects, so embedders can react to them without the TUI. It's called
+// from Update, so it mustn't block.
+func (self *WaitModel) WithNotify(fn func(WaitEvent)) *WaitModel {
+	self.notify = fn
+	return self
+}
+
 func (self *WaitModel) Wait() {
 	self.cancel(nil)
 	self.wg.Wait()
@@ -171,10 +696,58 @@ func (self *WaitModel) Wait() {
 
 func (self *WaitModel) Init() tea.Cmd {
 	self.startedAt = time.Now()
+	self.deadline = self.startedAt.Add(self.waitMax)
+	if !self.waitTill.IsZero() && self.waitTill.Before(self.deadline) {
+		self.deadline = self.waitTill
+	}
+	keys := make([]string, len(self.items))
+	for i, item := range self.items {
+		keys[i] = item.dataKey
+		if self.group {
+			keys[i] = item.name
+		}
+		if item.bucket != self.bucket {
+			keys[i] = item.bucket + "/" + keys[i]
+		}
+	}
+
+	self.queue = self.items
+	self.startLister()
 	return tea.Sequence(
-		tea.Println("waiting for ", self.object+sqlExt),
-		tickCmd(time.Second),
-		tea.Batch(self.waitStarted(), self.waitError(), self.waitOk()))
+		self.println("waiting for ", strings.Join(keys, ", ")),
+		tickCmd(self.tick),
+		self.startQueued())
+}
+
+// startQueued starts waiting for queued items, up to configured limit of
+// concurrently waited items.
+func (self *WaitModel) startQueued() tea.Cmd {
+	n := len(self.queue)
+	if self.maxActive > 0 {
+		n = max(min(n, self.maxActive-self.active()), 0)
+	}
+
+	waits := make([]tea.Cmd, 0, n*3)
+	for _, item := range self.queue[:n] {
+		item.active = true
+		if self.data {
+			waits = append(waits, self.waitDataObject(item))
+		} else {
+			waits = append(waits,
+				self.waitStarted(item), self.waitError(item), self.waitOk(item))
+		}
+	}
+	self.queue = self.queue[n:]
+	return tea.Batch(waits...)
+}
+
+func (self *WaitModel) active() (n int) {
+	for _, item := range self.items {
+		if item.active && !item.done {
+			n++
+		}
+	}
+	return
 }
 
 func (self *WaitModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -184,14 +757,17 @@ func (self *WaitModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case waitMsg:
 		return self.handleWaits(msg)
 	case tea.WindowSizeMsg:
-		self.progress.Width = msg.Width - barPad*2
-		if self.progress.Width > barMaxWidth {
-			self.progress.Width = barMaxWidth
-		}
+		self.resize(msg.Width)
+	case tea.ResumeMsg:
+		// The terminal could be resized, while we were suspended. The program
+		// checks it by itself, but on some terminals it doesn't get the new size,
+		// so ask it again.
+		return self, tea.WindowSize()
 	case tickMsg:
 		self.percent = min(1.0,
-			time.Since(self.startedAt).Seconds()/self.waitMax.Seconds())
-		return self, tickCmd(time.Second)
+			time.Since(self.startedAt).Seconds()/
+				self.deadline.Sub(self.startedAt).Seconds())
+		return self, tickCmd(self.tick)
 	}
 	return self, nil
 }
@@ -201,10 +777,16 @@ func (self *WaitModel) handleKeys(m tea.KeyMsg) (*WaitModel, tea.Cmd) {
 	case "ctrl+c", "q", "esc":
 		self.cancel(fmt.Errorf("by user input: %s", m.String()))
 		return self, self.quitCmd
+	case "ctrl+z":
+		return self, tea.Suspend
 	}
 	return self, nil
 }
 
+func (self *WaitModel) resize(width int) {
+	self.progress.Width = max(min(width-barPad*2, barMaxWidth), 1)
+}
+
 func (self *WaitModel) quitCmd() tea.Msg {
 	self.cancel(nil)
 	return tea.Quit()
@@ -212,23 +794,116 @@ func (self *WaitModel) quitCmd() tea.Msg {
 
 func (self *WaitModel) handleWaits(m waitMsg) (*WaitModel, tea.Cmd) {
 	style := &self.styles
+	item := m.item
+	if item.done {
+		return self, nil
+	}
 
 	if m.err != nil {
-		self.cancel(m.err)
-		return self, self.quitCmd
+		item.Done()
+		item.err = m.err
+		self.emit(WaitEvent{Name: item.name, Status: WaitError, Err: m.err})
+		failed := self.println(style.Red("✗ failed:"), self.label(item),
+			" [", time.Since(self.startedAt).Truncate(time.Second), "]\n",
+			errSnippet(m.err))
+		if (self.firstOk || self.waitAll) && self.pending() > 0 {
+			return self, tea.Sequence(failed, self.errorHook(item.name, m.err),
+				self.startQueued())
+		}
+		self.cancel(self.errors())
+		return self, tea.Sequence(failed, self.errorHook(item.name, m.err),
+			self.quitCmd)
 	} else if m.started {
-		return self, tea.Sequence(tea.Println(style.Green("✓ started"),
-			" [", time.Since(self.startedAt).Truncate(time.Second), "]"))
+		item.startedAt = time.Now()
+		self.emit(WaitEvent{Name: item.name, Status: WaitStarted})
+		return self, tea.Sequence(self.println(style.Green("✓ started"),
+			self.label(item),
+			" [", time.Since(self.startedAt).Truncate(time.Second), "]"),
+			self.startedHook(item.name))
 	}
 
-	self.contentLength = m.size
+	item.Done()
+	item.ok, item.size = true, m.size
+	self.emit(WaitEvent{Name: item.name, Status: WaitOk, Size: m.size})
 	humanSize, sizeSuffix := humanizeBytes(m.size, true)
 
-	return self, tea.Sequence(
-		tea.Println(style.Green("✓ ok:"),
-			" ", humanSize, " ", sizeSuffix,
+	cmds := []tea.Cmd{
+		self.println(style.Green("✓ ok:"), self.label(item),
+			" ", humanSize, " ", sizeSuffix, metaLabel(m.meta),
 			" [", time.Since(self.startedAt).Truncate(time.Second), "]"),
-		self.quitCmd)
+		self.okHook(item.name, m.size),
+	}
+	if self.firstOk {
+		cmds = append(cmds, self.quitCmd)
+	} else if self.pending() == 0 {
+		if err := self.errors(); err != nil {
+			self.cancel(err)
+		}
+		cmds = append(cmds, self.quitCmd)
+	} else {
+		cmds = append(cmds, self.startQueued())
+	}
+	return self, tea.Sequence(cmds...)
+}
+
+func (self *WaitModel) emit(ev WaitEvent) {
+	if self.notify != nil {
+		self.notify(ev)
+	}
+}
+
+func metaLabel(meta string) string {
+	if meta == "" {
+		return ""
+	}
+	return " " + meta
+}
+
+// label returns name of item for output lines, if we wait for multiple
+// objects. It's empty for single object, because it's printed by Init.
+func (self *WaitModel) label(item *waitItem) string {
+	if len(self.items) == 1 {
+		return ""
+	}
+	return " " + self.itemName(item)
+}
+
+// itemName returns name of item with its bucket, if it isn't the default
+// bucket.
+func (self *WaitModel) itemName(item *waitItem) string {
+	if item.bucket != self.bucket {
+		return item.bucket + "/" + item.name
+	}
+	return item.name
+}
+
+// errSnippet returns the beginning of err message, to show it in the TUI. The
+// whole message is printed on exit anyway.
+func errSnippet(err error) string {
+	s := []rune(strings.TrimSpace(err.Error()))
+	if len(s) > errSnippetLen {
+		return string(s[:errSnippetLen]) + "…"
+	}
+	return string(s)
+}
+
+func (self *WaitModel) pending() (n int) {
+	for _, item := range self.items {
+		if !item.done {
+			n++
+		}
+	}
+	return
+}
+
+func (self *WaitModel) errors() error {
+	var errs []error
+	for _, item := range self.items {
+		if item.err != nil {
+			errs = append(errs, item.err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (self *WaitModel) View() string {
@@ -247,37 +922,84 @@ func (self *WaitModel) View() string {
 	b.WriteString(self.progress.ViewAs(self.percent))
 
 	b.WriteString(" ")
-	timeLeft := self.waitMax - d
+	timeLeft := self.deadline.Sub(self.startedAt) - d
 	b.WriteString(timeLeft.Truncate(time.Second).String())
 
+	b.WriteString("\n")
+	b.WriteString(self.statusView())
 	b.WriteString("\n\n")
 	b.WriteString(style.Help())
 
 	return b.String()
 }
 
-func (self *WaitModel) waitStarted() tea.Cmd {
+// statusView returns status of objects, which aren't done yet: pending, if
+// their .started hasn't appeared yet, or running, if it has.
+func (self *WaitModel) statusView() string {
+	var pending, running int
+	for _, item := range self.items {
+		switch {
+		case item.done:
+		case item.startedAt.IsZero():
+			pending++
+		default:
+			running++
+		}
+	}
+
+	style := &self.styles
+	var s []string
+	if pending > 0 {
+		s = append(s, style.Warn(self.countLabel(pending, self.pendingLabel)))
+	}
+	if running > 0 {
+		s = append(s, style.Green(self.countLabel(running, runningLabel)))
+	}
+	return style.Since() + strings.Join(s, ", ")
+}
+
+func (self *WaitModel) countLabel(n int, label string) string {
+	if len(self.items) == 1 {
+		return label
+	}
+	return strconv.Itoa(n) + " " + label
+}
+
+func (self *WaitModel) waitStarted(item *waitItem) tea.Cmd {
 	self.wg.Add(1)
 	return func() tea.Msg {
 		defer self.wg.Done()
-		err := self.waitObject(self.running, self.object+startedExt)
+		err := self.waitObject(item.running, item, item.name+startedExt)
 		if err != nil {
-			return waitMsg{err: err}
+			return waitMsg{item: item, err: err}
 		}
-		return waitMsg{started: true}
+		return waitMsg{item: item, started: true}
 	}
 }
 
-func (self *WaitModel) waitObject(ctx context.Context, key string,
+func (self *WaitModel) waitObject(ctx context.Context, item *waitItem,
+	key string,
 	callbacks ...func(headObject *s3.HeadObjectOutput),
 ) error {
-	h, err := s3.NewObjectExistsWaiter(self.client).WaitForOutput(
-		ctx, &s3.HeadObjectInput{
-			Bucket: aws.String(self.bucket),
-			Key:    aws.String(key),
-		}, self.waitMax)
+	// All waiters share the same deadline, so nobody waits longer than waitMax
+	// since Init or after absolute deadline, regardless of when it started.
+	ctx, cancel := context.WithDeadline(ctx, self.deadline)
+	defer cancel()
+
+	var h *s3.HeadObjectOutput
+	var err error
+	if self.lister != nil {
+		h, err = self.lister.Wait(ctx, key)
+	} else if self.pollList {
+		h, err = self.waitListed(ctx, item, key)
+	} else {
+		h, err = waitObjectExists(ctx, item.client, item.bucket, key,
+			time.Until(self.deadline), func(o *s3.ObjectExistsWaiterOptions) {
+				o.MaxDelay = self.pollMaxDelay
+			})
+	}
 	if err != nil {
-		return fmt.Errorf("wait for %q: %w", key, err)
+		return err
 	}
 
 	for _, fn := range callbacks {
@@ -286,23 +1008,26 @@ func (self *WaitModel) waitObject(ctx context.Context, key string,
 	return nil
 }
 
-func (self *WaitModel) waitError() tea.Cmd {
+func (self *WaitModel) waitError(item *waitItem) tea.Cmd {
 	self.wg.Add(1)
 	return func() tea.Msg {
 		defer self.wg.Done()
-		key := self.object + errorExt
-		if err := self.waitObject(self.running, key); err != nil {
-			return waitMsg{err: err}
+		key := item.name + errorExt
+		if err := self.waitObject(item.running, item, key); err != nil {
+			return waitMsg{item: item, err: err}
 		}
 		return waitMsg{
-			err: fmt.Errorf("remote error:\n%w", self.readError(self.running, key)),
+			item: item,
+			err:  fmt.Errorf("remote error:\n%w", self.readError(item.running, item, key)),
 		}
 	}
 }
 
-func (self *WaitModel) readError(ctx context.Context, key string) error {
-	resp, err := self.client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(self.bucket),
+func (self *WaitModel) readError(ctx context.Context, item *waitItem,
+	key string,
+) error {
+	resp, err := item.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(item.bucket),
 		Key:    aws.String(key),
 	})
 	if err != nil {
@@ -310,39 +1035,159 @@ func (self *WaitModel) readError(ctx context.Context, key string) error {
 	}
 	defer resp.Body.Close()
 
-	b, err := io.ReadAll(resp.Body)
+	// Some producers write the whole log there.
+	b, err := io.ReadAll(io.LimitReader(resp.Body, self.maxErrorBytes+1))
 	if err != nil {
 		return fmt.Errorf("reading all from %q: %w", key, err)
+	} else if int64(len(b)) > self.maxErrorBytes {
+		return errors.New(string(b[:self.maxErrorBytes]) + "\n...(truncated)")
 	}
 	return errors.New(string(b))
 }
 
-func (self *WaitModel) waitOk() tea.Cmd {
+func (self *WaitModel) waitOk(item *waitItem) tea.Cmd {
 	self.wg.Add(1)
 	return func() tea.Msg {
 		defer self.wg.Done()
-		if err := self.waitObject(self.running, self.object+okExt); err != nil {
-			return waitMsg{err: err}
+		err := self.waitObject(item.running, item, item.name+okExt)
+		if err != nil {
+			return waitMsg{item: item, err: err}
 		}
 
-		size, err := self.size(self.running, self.object+sqlExt)
+		if self.group {
+			var size int64
+			err := self.transientRetry(item.running,
+				func(ctx context.Context) (err error) {
+					size, err = self.groupSize(ctx, item)
+					return
+				})
+			if err != nil {
+				return waitMsg{item: item, err: err}
+			}
+			return waitMsg{item: item, size: size}
+		}
+
+		key := item.dataKey
+		var h *s3.HeadObjectOutput
+		err = self.transientRetry(item.running,
+			func(ctx context.Context) (err error) {
+				h, err = self.headData(ctx, item, key)
+				return
+			})
 		if err != nil {
-			return waitMsg{err: err}
+			return waitMsg{item: item, err: err}
+		}
+
+		size := aws.ToInt64(h.ContentLength)
+		if err := checkEmpty(key, size, self.allowEmpty); err != nil {
+			return waitMsg{item: item, err: err}
 		}
+		return waitMsg{item: item, size: size, meta: self.selectMeta(h.Metadata)}
+	}
+}
 
-		return waitMsg{size: size}
+func (self *WaitModel) waitDataObject(item *waitItem) tea.Cmd {
+	self.wg.Add(1)
+	return func() tea.Msg {
+		defer self.wg.Done()
+		key := item.dataKey
+		var size int64
+		var meta string
+		err := self.waitObject(item.running, item, key,
+			func(h *s3.HeadObjectOutput) {
+				size = aws.ToInt64(h.ContentLength)
+				meta = self.selectMeta(h.Metadata)
+			})
+		if err != nil {
+			return waitMsg{item: item, err: err}
+		} else if err := checkEmpty(key, size, self.allowEmpty); err != nil {
+			return waitMsg{item: item, err: err}
+		}
+		return waitMsg{item: item, size: size, meta: meta}
 	}
 }
 
-func (self *WaitModel) size(ctx context.Context, key string) (int64, error) {
-	resp, err := self.client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(self.bucket),
+// headData returns HeadObjectOutput of data object. With --poll-via list it
+// has fields from the listing only, without metadata.
+func (self *WaitModel) headData(ctx context.Context, item *waitItem,
+	key string,
+) (*s3.HeadObjectOutput, error) {
+	if self.pollList {
+		h, err := self.listObject(ctx, item, key)
+		if err != nil {
+			return nil, fmt.Errorf("listing %q: %w", key, err)
+		}
+		return h, nil
+	}
+
+	resp, err := item.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(item.bucket),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		return 0, fmt.Errorf("heading %q: %w", key, err)
+		return nil, fmt.Errorf("heading %q: %w", key, err)
+	}
+	return resp, nil
+}
+
+// selectMeta returns configured keys of user metadata as key=value pairs.
+func (self *WaitModel) selectMeta(meta map[string]string) string {
+	pairs := make([]string, 0, len(self.showMeta))
+	for _, k := range self.showMeta {
+		if v, ok := meta[k]; ok {
+			pairs = append(pairs, k+"="+v)
+		}
+	}
+	return strings.Join(pairs, " ")
+}
+
+// checkEmpty returns an error, if size of data object is zero and it isn't
+// allowed. An empty dump is usually a failed producer.
+func checkEmpty(key string, size int64, allow bool) error {
+	if size == 0 && !allow {
+		return fmt.Errorf("%q is empty, use --allow-empty to accept it", key)
+	}
+	return nil
+}
+
+func waitObjectExists(ctx context.Context, client *s3.Client, bucket, key string,
+	maxWait time.Duration, optFns ...func(*s3.ObjectExistsWaiterOptions),
+) (*s3.HeadObjectOutput, error) {
+	optFns = append([]func(*s3.ObjectExistsWaiterOptions){
+		func(o *s3.ObjectExistsWaiterOptions) {
+			o.Retryable = objectExistsRetryable
+		},
+	}, optFns...)
+	h, err := s3.NewObjectExistsWaiter(client, optFns...).WaitForOutput(
+		ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		}, maxWait)
+	if err != nil {
+		return nil, fmt.Errorf("wait for %q: %w", key, err)
+	}
+	return h, nil
+}
+
+// objectExistsRetryable is like default retryable of s3.ObjectExistsWaiter,
+// which retries on any error, but it fails fast on 403, because a
+// misconfigured policy never fixes itself while we are waiting. Without
+// s3:ListBucket HeadObject of missing object returns 403 instead of 404.
+func objectExistsRetryable(ctx context.Context, input *s3.HeadObjectInput,
+	output *s3.HeadObjectOutput, err error,
+) (bool, error) {
+	if err == nil {
+		return false, nil
+	}
+
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) &&
+		respErr.HTTPStatusCode() == http.StatusForbidden {
+		return false, fmt.Errorf(
+			"access denied, check s3:GetObject and s3:ListBucket permissions: %w",
+			err)
 	}
-	return aws.ToInt64(resp.ContentLength), nil
+	return true, nil
 }
 
 func humanizeBytes(s int64, iec bool) (string, string) {
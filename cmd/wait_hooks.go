@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// hookMinTimeout is the least time a hook has to run, even if it's started
+	// after the deadline of wait, like on-error of the timeout.
+	hookMinTimeout = 30 * time.Second
+
+	// hookWaitDelay is how long to wait for output of a killed hook, which can
+	// be held by its children.
+	hookWaitDelay = time.Second
+)
+
+// WaitHooks are shell commands, executed by WaitModel on phase transitions.
+// Every command executed by sh -c with object name as $1 and, for OnOk, size
+// of the object as $2. The same values are available as DBCOPY_OBJECT and
+// DBCOPY_SIZE env vars. OnError gets the error message as DBCOPY_ERROR env
+// var.
+type WaitHooks struct {
+	OnStarted string
+	OnOk      string
+	OnError   string
+
+	// Strict makes a failed hook fatal for the wait. By default failures are
+	// only printed.
+	Strict bool
+}
+
+func (self *WaitModel) WithHooks(hooks WaitHooks) *WaitModel {
+	self.hooks = hooks
+	return self
+}
+
+// WithWarnings configures WaitModel to write warnings, like failed hooks, into
+// w, because the program prints nothing, like with --quiet-success.
+func (self *WaitModel) WithWarnings(w io.Writer) *WaitModel {
+	self.warnings = w
+	return self
+}
+
+func (self *WaitModel) startedHook(object string) tea.Cmd {
+	return self.hookCmd("on-started", self.hooks.OnStarted, object, nil)
+}
+
+func (self *WaitModel) okHook(object string, size int64) tea.Cmd {
+	return self.hookCmd("on-ok", self.hooks.OnOk, object, []string{
+		strconv.FormatInt(size, 10),
+	}, "DBCOPY_SIZE="+strconv.FormatInt(size, 10))
+}
+
+func (self *WaitModel) errorHook(object string, err error) tea.Cmd {
+	return self.hookCmd("on-error", self.hooks.OnError, object, nil,
+		"DBCOPY_ERROR="+err.Error())
+}
+
+func (self *WaitModel) hookCmd(name, cmdline, object string, args []string,
+	env ...string,
+) tea.Cmd {
+	if cmdline == "" {
+		return nil
+	}
+
+	return func() tea.Msg {
+		ctx, cancel := self.hookContext()
+		defer cancel()
+
+		err := runHook(ctx, cmdline, append([]string{object}, args...),
+			append(env, "DBCOPY_OBJECT="+object))
+		if err == nil {
+			return nil
+		}
+
+		err = fmt.Errorf("%s hook: %w", name, err)
+		if self.hooks.Strict {
+			self.cancel(err)
+			return tea.Quit()
+		} else if self.warnings != nil {
+			fmt.Fprintln(self.warnings, "WARNING:", err)
+			return nil
+		}
+		return self.println(self.styles.Warn("✗ ", err.Error()))()
+	}
+}
+
+// hookContext returns context of a hook, which is done at the deadline of
+// WaitModel, but not earlier than hookMinTimeout from now.
+func (self *WaitModel) hookContext() (context.Context, context.CancelFunc) {
+	deadline := self.deadline
+	if t := time.Now().Add(hookMinTimeout); deadline.Before(t) {
+		deadline = t
+	}
+	return context.WithDeadline(context.Background(), deadline)
+}
+
+func runHook(ctx context.Context, cmdline string, args, env []string) error {
+	cmd := exec.CommandContext(ctx, "sh",
+		append([]string{"-c", cmdline, "sh"}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.WaitDelay = hookWaitDelay
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%w: %w", err, context.Cause(ctx))
+		}
+		if s := strings.TrimSpace(string(out)); s != "" {
+			return fmt.Errorf("run %q: %w: %s", cmdline, err, s)
+		}
+		return fmt.Errorf("run %q: %w", cmdline, err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHook(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	t.Setenv("OUT", out)
+	cmdline := `printf '%s|%s|%s|%s|%s' "$0" "$1" "$2" "$DBCOPY_OBJECT" ` +
+		`"$DBCOPY_SIZE" > "$OUT"`
+
+	err := runHook(context.Background(), cmdline, []string{"foo", "42"},
+		[]string{"DBCOPY_OBJECT=foo", "DBCOPY_SIZE=42"})
+	if err != nil {
+		t.Fatalf("runHook(): %v", err)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := string(b), "sh|foo|42|foo|42"; got != want {
+		t.Errorf("hook got %q, want %q", got, want)
+	}
+}
+
+func TestRunHook_error(t *testing.T) {
+	err := runHook(context.Background(), "echo oops; exit 3", nil, nil)
+	if err == nil {
+		t.Fatal("runHook() = nil, want error")
+	} else if !strings.Contains(err.Error(), "exit status 3: oops") {
+		t.Errorf("runHook() = %v, want exit status and output", err)
+	}
+}
+
+func TestRunHook_timeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err := runHook(ctx, "sleep 10", nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("runHook() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(started); d > 5*time.Second {
+		t.Errorf("runHook() returned after %v", d)
+	}
+}
+
+func TestWaitModel_hookContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		deadline time.Duration
+		want     time.Duration
+	}{
+		{name: "passed deadline", deadline: -time.Hour, want: hookMinTimeout},
+		{name: "close deadline", deadline: time.Second, want: hookMinTimeout},
+		{name: "far deadline", deadline: time.Hour, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewWaitModel(nil, "bucket", "foo")
+			m.deadline = time.Now().Add(tt.deadline)
+			ctx, cancel := m.hookContext()
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				t.Fatal("hook context has no deadline")
+			}
+			d := time.Until(deadline)
+			if d > tt.want || d < tt.want-time.Second {
+				t.Errorf("hook deadline in %v, want %v", d, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitModel_hookCmd(t *testing.T) {
+	tests := []struct {
+		name       string
+		strict     bool
+		wantCancel bool
+	}{
+		{name: "warning"},
+		{name: "strict", strict: true, wantCancel: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings bytes.Buffer
+			m := NewWaitModel(nil, "bucket", "foo").
+				WithHooks(WaitHooks{OnOk: "exit 1", Strict: tt.strict}).
+				WithWarnings(&warnings)
+			m.okHook("foo", 42)()
+
+			err := context.Cause(m.running)
+			if !tt.wantCancel {
+				if err != nil {
+					t.Errorf("wait canceled by %v", err)
+				} else if !strings.Contains(warnings.String(), "on-ok hook") {
+					t.Errorf("warnings %q, want failed on-ok hook",
+						warnings.String())
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), "on-ok hook") {
+				t.Errorf("wait canceled by %v, want failed on-ok hook", err)
+			} else if warnings.Len() != 0 {
+				t.Errorf("unexpected warnings %q", warnings.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/dsh2dsh/expx-dbcopy/internal/retry"
+)
+
+const (
+	pollViaHead = "head"
+	pollViaList = "list"
+
+	// The same delays, like s3.ObjectExistsWaiter has by default.
+	listMinDelay = 5 * time.Second
+	listMaxDelay = 120 * time.Second
+)
+
+var errNotListed = errors.New("not listed")
+
+// WithPollViaList configures WaitModel to check objects by ListObjectsV2,
+// instead of HeadObject, for buckets where HeadObject isn't allowed.
+func (self *WaitModel) WithPollViaList(v bool) *WaitModel {
+	self.pollList = v
+	return self
+}
+
+func (self *WaitModel) waitListed(ctx context.Context, item *waitItem,
+	key string,
+) (h *s3.HeadObjectOutput, err error) {
+	policy := retry.Policy{BaseDelay: listMinDelay, MaxDelay: self.pollMaxDelay}
+	err = retry.Do(ctx, policy, func(ctx context.Context) (err error) {
+		h, err = self.listObject(ctx, item, key)
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) &&
+			respErr.HTTPStatusCode() == http.StatusForbidden {
+			return retry.Permanent(
+				fmt.Errorf("access denied, check permissions: %w", err))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("wait for %q: %w", key, err)
+	}
+	return h, nil
+}
+
+// listObject lists objects with key prefix and returns the one with exact key
+// as HeadObjectOutput, with fields known from the listing. It returns
+// errNotListed if there is no such object.
+func (self *WaitModel) listObject(ctx context.Context, item *waitItem,
+	key string,
+) (*s3.HeadObjectOutput, error) {
+	pager := s3.NewListObjectsV2Paginator(item.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(item.bucket),
+		Prefix: aws.String(key),
+	})
+
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list %q: %w", key, err)
+		}
+		for i := range page.Contents {
+			if obj := &page.Contents[i]; aws.ToString(obj.Key) == key {
+				return &s3.HeadObjectOutput{
+					ContentLength: obj.Size,
+					ETag:          obj.ETag,
+					LastModified:  obj.LastModified,
+				}, nil
+			}
+		}
+	}
+	return nil, errNotListed
+}
+
+// WithGroup configures WaitModel to wait for groups of objects: every name is
+// a group of all objects named name.* or name/*, like multi-file backup, which
+// has single name.ok marker. Size of the group is total size of its members.
+func (self *WaitModel) WithGroup(v bool) *WaitModel {
+	self.group = v
+	return self
+}
+
+// groupSize returns total size of all members of item's group, except its
+// markers.
+func (self *WaitModel) groupSize(ctx context.Context, item *waitItem,
+) (int64, error) {
+	pager := s3.NewListObjectsV2Paginator(item.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(item.bucket),
+		Prefix: aws.String(item.name),
+	})
+
+	var size int64
+	var members int
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("list %q: %w", item.name, err)
+		}
+		for i := range page.Contents {
+			obj := &page.Contents[i]
+			key := aws.ToString(obj.Key)
+			switch key {
+			case item.name + okExt, item.name + startedExt, item.name + errorExt:
+				continue
+			}
+			if !groupMember(item.name, key) {
+				continue
+			}
+			size += aws.ToInt64(obj.Size)
+			members++
+		}
+	}
+
+	if members == 0 {
+		return 0, fmt.Errorf("group %q has no members", item.name)
+	} else if err := checkEmpty(item.name, size, self.allowEmpty); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// groupMember returns true, if key is a member of group name. Name prefix
+// isn't enough, because group db1 isn't a group of db10.sql.
+func groupMember(name, key string) bool {
+	rest, ok := strings.CutPrefix(key, name)
+	return ok && rest != "" && (rest[0] == '.' || rest[0] == '/')
+}
+
+// WithConcurrentMarkers configures WaitModel to check markers of all objects
+// by the same ListObjectsV2 calls over their common prefix, instead of
+// polling every marker separately. It falls back to separate polling, if
+// objects have no common prefix.
+func (self *WaitModel) WithConcurrentMarkers(v bool) *WaitModel {
+	self.concurrentMarkers = v
+	return self
+}
+
+// startLister starts polling common prefix of all objects, if it's enabled
+// and there is such prefix in the same bucket.
+func (self *WaitModel) startLister() {
+	if !self.concurrentMarkers || len(self.items) < 2 {
+		return
+	}
+
+	first := self.items[0]
+	prefix := first.name
+	for _, item := range self.items[1:] {
+		if item.bucket != first.bucket {
+			return
+		}
+		prefix = commonPrefix(prefix, item.name)
+	}
+	if prefix == "" {
+		return
+	}
+
+	self.lister = newPrefixLister(first.client, first.bucket, prefix)
+	self.lister.maxDelay = self.pollMaxDelay
+	self.wg.Add(1)
+	go func() {
+		defer self.wg.Done()
+		self.lister.Run(self.running)
+	}()
+}
+
+func commonPrefix(a, b string) string {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[i] != b[i] {
+			return a[:i]
+		}
+	}
+	return a[:n]
+}
+
+// ==================================================
+
+func newPrefixLister(client *s3.Client, bucket, prefix string) *prefixLister {
+	return &prefixLister{
+		client: client,
+		bucket: bucket,
+		prefix: prefix,
+
+		maxDelay: listMaxDelay,
+
+		listed:  make(map[string]*s3.HeadObjectOutput),
+		changed: make(chan struct{}),
+	}
+}
+
+// prefixLister periodically lists all objects with prefix and notifies
+// everybody, who waits for some of them.
+type prefixLister struct {
+	client *s3.Client
+	bucket string
+	prefix string
+
+	maxDelay time.Duration
+
+	mu      sync.Mutex
+	listed  map[string]*s3.HeadObjectOutput
+	changed chan struct{}
+	err     error
+}
+
+func (self *prefixLister) Run(ctx context.Context) {
+	policy := retry.Policy{BaseDelay: listMinDelay, MaxDelay: self.maxDelay}
+	err := retry.Do(ctx, policy, func(ctx context.Context) error {
+		if err := self.list(ctx); err != nil {
+			var respErr *awshttp.ResponseError
+			if errors.As(err, &respErr) &&
+				respErr.HTTPStatusCode() == http.StatusForbidden {
+				return retry.Permanent(
+					fmt.Errorf("access denied, check permissions: %w", err))
+			}
+		}
+		// Never stop polling by itself, only by ctx.
+		return errNotListed
+	})
+
+	self.mu.Lock()
+	self.err = err
+	close(self.changed)
+	self.mu.Unlock()
+}
+
+func (self *prefixLister) list(ctx context.Context) error {
+	pager := s3.NewListObjectsV2Paginator(self.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(self.bucket),
+		Prefix: aws.String(self.prefix),
+	})
+
+	listed := make(map[string]*s3.HeadObjectOutput)
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("list %q: %w", self.prefix, err)
+		}
+		for i := range page.Contents {
+			obj := &page.Contents[i]
+			listed[aws.ToString(obj.Key)] = &s3.HeadObjectOutput{
+				ContentLength: obj.Size,
+				ETag:          obj.ETag,
+				LastModified:  obj.LastModified,
+			}
+		}
+	}
+
+	self.mu.Lock()
+	self.listed = listed
+	close(self.changed)
+	self.changed = make(chan struct{})
+	self.mu.Unlock()
+	return nil
+}
+
+// Wait waits until key is listed, or ctx is done, or listing failed.
+func (self *prefixLister) Wait(ctx context.Context, key string,
+) (*s3.HeadObjectOutput, error) {
+	for {
+		self.mu.Lock()
+		h, ok := self.listed[key]
+		changed, err := self.changed, self.err
+		self.mu.Unlock()
+
+		if ok {
+			return h, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("wait for %q: %w", key, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("wait for %q: %w", key, context.Cause(ctx))
+		case <-changed:
+		}
+	}
+}
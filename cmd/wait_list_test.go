@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestCommonPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{name: "empty", want: ""},
+		{name: "one empty", a: "db/prod", want: ""},
+		{name: "equal", a: "db/prod", b: "db/prod", want: "db/prod"},
+		{name: "shared dir", a: "db/prod", b: "db/test", want: "db/"},
+		{name: "one is prefix", a: "db/prod", b: "db/prod2", want: "db/prod"},
+		{name: "other is prefix", a: "db/prod2", b: "db/prod", want: "db/prod"},
+		{name: "nothing shared", a: "prod", b: "test", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commonPrefix(tt.a, tt.b); got != tt.want {
+				t.Errorf("commonPrefix(%q, %q) = %q, want %q", tt.a, tt.b, got,
+					tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitModel_groupSize(t *testing.T) {
+	s3 := newFakeS3(t)
+	s3.Put("bucket", "db1.sql", []byte("123"))
+	s3.Put("bucket", "db1/part2", []byte("4567"))
+	s3.Put("bucket", "db1"+okExt, nil)
+	s3.Put("bucket", "db10.sql", []byte("neighbour"))
+	s3.Put("bucket", "db1x", []byte("neighbour"))
+
+	m := NewWaitModel(s3.Client(), "bucket", "db1", "db2").WithGroup(true)
+	size, err := m.groupSize(context.Background(), m.items[0])
+	if err != nil {
+		t.Fatalf("groupSize(db1): %v", err)
+	} else if size != 7 {
+		t.Errorf("groupSize(db1) = %d, want 7", size)
+	}
+
+	s3.Put("bucket", "db2x.sql", []byte("neighbour"))
+	if size, err := m.groupSize(context.Background(), m.items[1]); err == nil {
+		t.Errorf("groupSize(db2) = %d, want error", size)
+	}
+}
+
+func TestGroupMember(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "db1.sql", want: true},
+		{key: "db1.part2.sql", want: true},
+		{key: "db1/part1", want: true},
+		{key: "db1", want: false},
+		{key: "db10.sql", want: false},
+		{key: "db1x", want: false},
+		{key: "db", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := groupMember("db1", tt.key); got != tt.want {
+				t.Errorf("groupMember(db1, %q) = %v, want %v", tt.key, got,
+					tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixLister(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.Put("bucket", "db/a"+okExt, nil)
+	fake.Put("bucket", "db/b"+okExt, nil)
+	fake.Put("bucket", "db/c"+sqlExt, []byte("content"))
+
+	lister := newPrefixLister(fake.Client(), "bucket", "db/")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lister.Run(ctx)
+	}()
+
+	keys := []string{"db/a" + okExt, "db/b" + okExt, "db/c" + sqlExt}
+	for _, key := range keys {
+		if _, err := lister.Wait(ctx, key); err != nil {
+			t.Errorf("Wait(%q): %v", key, err)
+		}
+	}
+
+	var lists int
+	for _, req := range fake.Requests() {
+		if strings.Contains(req, "list-type=2") {
+			lists++
+		}
+	}
+	if lists != 1 {
+		t.Errorf("%d listings, want 1 for all keys", lists)
+	}
+
+	cancel()
+	<-done
+	if _, err := lister.Wait(context.Background(), "db/c"+okExt); err == nil {
+		t.Error("Wait() of missing key after Run = nil, want error")
+	}
+}
+
+func TestWaitModel_listObject(t *testing.T) {
+	fake := newFakeS3(t)
+	obj := fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+	fake.Put("bucket", "bar"+sqlExt+".tmp", []byte("neighbour"))
+
+	m := NewWaitModel(fake.Client(), "bucket", "foo", "bar").
+		WithPollViaList(true)
+	h, err := m.listObject(context.Background(), m.items[0], "foo"+sqlExt)
+	if err != nil {
+		t.Fatalf("listObject(foo): %v", err)
+	} else if aws.ToInt64(h.ContentLength) != 7 {
+		t.Errorf("size %d, want 7", aws.ToInt64(h.ContentLength))
+	} else if aws.ToString(h.ETag) != obj.ETag() {
+		t.Errorf("etag %q, want %q", aws.ToString(h.ETag), obj.ETag())
+	}
+
+	// Only exact key matches, not any key with the prefix.
+	_, err = m.listObject(context.Background(), m.items[1], "bar"+sqlExt)
+	if !errors.Is(err, errNotListed) {
+		t.Errorf("listObject(bar) = %v, want %v", err, errNotListed)
+	}
+}
+
+func TestWaitModel_waitListed_forbidden(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.Handler = func(w http.ResponseWriter, r *http.Request) bool {
+		writeFakeError(w, http.StatusForbidden, "AccessDenied")
+		return true
+	}
+
+	m := NewWaitModel(fake.Client(), "bucket", "foo").WithPollViaList(true)
+	started := time.Now()
+	_, err := m.waitListed(context.Background(), m.items[0], "foo"+sqlExt)
+	if err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("waitListed() = %v, want access denied", err)
+	} else if d := time.Since(started); d >= listMinDelay {
+		t.Errorf("waitListed() retried for %v", d)
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WaitSummary is the final outcome of WaitModel, written by
+// --json-summary-file.
+type WaitSummary struct {
+	Result     string              `json:"result"`
+	Error      string              `json:"error,omitempty"`
+	StartedAt  time.Time           `json:"started_at"`
+	FinishedAt time.Time           `json:"finished_at"`
+	Duration   float64             `json:"duration_seconds"`
+	Objects    []WaitObjectSummary `json:"objects"`
+}
+
+// WaitObjectSummary is the outcome of one object. StartedWait is time from
+// start of wait till name.started, and RunDuration is time from
+// name.started till the outcome, if name.started was seen.
+type WaitObjectSummary struct {
+	Bucket      string     `json:"bucket"`
+	Name        string     `json:"name"`
+	Result      string     `json:"result"`
+	Size        int64      `json:"size,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	StartedWait float64    `json:"started_wait_seconds,omitempty"`
+	RunDuration float64    `json:"run_seconds,omitempty"`
+}
+
+const (
+	resultOk      = "ok"
+	resultError   = "error"
+	resultPending = "pending"
+)
+
+// Summary returns the outcome of WaitModel, which finished with cause.
+func (self *WaitModel) Summary(cause error) WaitSummary {
+	finished := time.Now()
+	summary := WaitSummary{
+		Result:     resultOk,
+		StartedAt:  self.startedAt,
+		FinishedAt: finished,
+		Duration:   finished.Sub(self.startedAt).Seconds(),
+		Objects:    make([]WaitObjectSummary, len(self.items)),
+	}
+	if cause != nil && !errors.Is(cause, context.Canceled) {
+		summary.Result, summary.Error = resultError, cause.Error()
+	}
+
+	for i, item := range self.items {
+		obj := &summary.Objects[i]
+		obj.Bucket, obj.Name = item.bucket, item.name
+		switch {
+		case item.ok:
+			obj.Result, obj.Size = resultOk, item.size
+		case item.err != nil:
+			obj.Result, obj.Error = resultError, item.err.Error()
+		default:
+			obj.Result = resultPending
+		}
+
+		if !item.startedAt.IsZero() {
+			obj.StartedAt = &item.startedAt
+			obj.StartedWait = item.startedAt.Sub(self.startedAt).Seconds()
+		}
+		if !item.finishedAt.IsZero() && (item.ok || item.err != nil) {
+			obj.FinishedAt = &item.finishedAt
+			if obj.StartedAt != nil {
+				obj.RunDuration = item.finishedAt.Sub(item.startedAt).Seconds()
+			}
+		}
+	}
+	return summary
+}
+
+// WriteSummary writes Summary into fname atomically: it writes a temporary
+// file in the same directory and renames it, so readers never see partial
+// content.
+func (self *WaitModel) WriteSummary(fname string, cause error) error {
+	b, err := json.MarshalIndent(self.Summary(cause), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal summary: %w", err)
+	}
+	return writeFileAtomic(fname, append(b, '\n'))
+}
+
+func writeFileAtomic(fname string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(fname), "."+filepath.Base(fname)+".*")
+	if err != nil {
+		return fmt.Errorf("create temp file for %q: %w", fname, err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return fmt.Errorf("write %q: %w", f.Name(), err)
+	} else if err := f.Chmod(0o644); err != nil {
+		return fmt.Errorf("chmod %q: %w", f.Name(), err)
+	} else if err := f.Close(); err != nil {
+		return fmt.Errorf("close %q: %w", f.Name(), err)
+	} else if err := os.Rename(f.Name(), fname); err != nil {
+		return fmt.Errorf("rename into %q: %w", fname, err)
+	}
+	return nil
+}
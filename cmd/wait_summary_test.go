@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWaitModel_WriteSummary(t *testing.T) {
+	m := NewWaitModel(nil, "bucket", "a", "b", "c").WithWaitAll(true).
+		WithPlain(io.Discard)
+	m.Init()
+	m.Update(waitMsg{item: m.items[0], started: true})
+	m.Update(waitMsg{item: m.items[0], size: 42})
+	m.Update(waitMsg{item: m.items[1], err: errTest})
+
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "summary.json")
+	if err := m.WriteSummary(fname, errTest); err != nil {
+		t.Fatalf("WriteSummary(): %v", err)
+	}
+
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary WaitSummary
+	if err := json.Unmarshal(b, &summary); err != nil {
+		t.Fatalf("unmarshal summary: %v", err)
+	}
+
+	if summary.Result != resultError || summary.Error != errTest.Error() {
+		t.Errorf("result %q (%q), want %q (%q)", summary.Result, summary.Error,
+			resultError, errTest)
+	}
+	want := []struct {
+		result  string
+		size    int64
+		started bool
+	}{
+		{result: resultOk, size: 42, started: true},
+		{result: resultError},
+		{result: resultPending},
+	}
+	if len(summary.Objects) != len(want) {
+		t.Fatalf("%d objects, want %d", len(summary.Objects), len(want))
+	}
+	for i, want := range want {
+		obj := summary.Objects[i]
+		if obj.Bucket != "bucket" || obj.Result != want.result ||
+			obj.Size != want.size || (obj.StartedAt != nil) != want.started {
+			t.Errorf("object %d: %+v, want %+v", i, obj, want)
+		}
+	}
+
+	// Temporary file is renamed.
+	if entries, err := os.ReadDir(dir); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 {
+		t.Errorf("%d files in dir, want only summary", len(entries))
+	}
+}
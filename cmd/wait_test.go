@@ -0,0 +1,933 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var errTest = errors.New("test error")
+
+func TestWait_quietSuccess(t *testing.T) {
+	tests := []struct {
+		name     string
+		marker   string
+		wantErr  bool
+		wantLine string
+	}{
+		{name: "ok", marker: okExt, wantLine: "✓ ok:"},
+		{name: "failed", marker: errorExt, wantErr: true, wantLine: "✗ failed:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+			fake.Put("bucket", "foo"+tt.marker, []byte("dump failed"))
+
+			oldClient, oldBucket := s3Client, s3Bucket
+			oldQuiet, oldMax := quietSuccess, waitMax
+			oldLog := log.Writer()
+			s3Client, s3Bucket = fake.Client(), "bucket"
+			quietSuccess, waitMax = true, time.Minute
+			var logBuf bytes.Buffer
+			log.SetOutput(&logBuf)
+			t.Cleanup(func() {
+				s3Client, s3Bucket = oldClient, oldBucket
+				quietSuccess, waitMax = oldQuiet, oldMax
+				log.SetOutput(oldLog)
+			})
+
+			err := Wait("foo")
+			if tt.wantErr && err == nil {
+				t.Error("Wait() = nil, want error")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("Wait(): %v", err)
+			}
+
+			// Execute prints held log output, if the command failed.
+			if !strings.Contains(logBuf.String(), tt.wantLine) {
+				t.Errorf("log %q, want %q in it", logBuf.String(), tt.wantLine)
+			}
+		})
+	}
+}
+
+// responseError returns error of the SDK with HTTP status code.
+func responseError(status int) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{
+				Response: &http.Response{StatusCode: status},
+			},
+			Err: errors.New(http.StatusText(status)),
+		},
+	}
+}
+
+func TestObjectExistsRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantRetry bool
+		wantErr   string
+	}{
+		{name: "exists"},
+		{
+			name:    "forbidden",
+			err:     responseError(http.StatusForbidden),
+			wantErr: "s3:ListBucket",
+		},
+		{
+			name:      "not found",
+			err:       responseError(http.StatusNotFound),
+			wantRetry: true,
+		},
+		{
+			name:      "internal error",
+			err:       responseError(http.StatusInternalServerError),
+			wantRetry: true,
+		},
+		{
+			name:      "service unavailable",
+			err:       responseError(http.StatusServiceUnavailable),
+			wantRetry: true,
+		},
+		{name: "network", err: errors.New("connection reset"), wantRetry: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retry, err := objectExistsRetryable(context.Background(), nil, nil,
+				tt.err)
+			if retry != tt.wantRetry {
+				t.Errorf("retry = %v, want %v", retry, tt.wantRetry)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q in it", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// runCmd runs cmd and all commands of sequences and batches, it returns, and
+// returns their messages. It must not get commands, which wait for objects.
+func runCmd(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+
+	msg := cmd()
+	v := reflect.ValueOf(msg)
+	if v.Kind() != reflect.Slice || v.Type().Elem() != reflect.TypeOf(cmd) {
+		return []tea.Msg{msg}
+	}
+
+	var msgs []tea.Msg
+	for i := range v.Len() {
+		msgs = append(msgs, runCmd(v.Index(i).Interface().(tea.Cmd))...)
+	}
+	return msgs
+}
+
+// quits returns true, if msgs has tea.QuitMsg.
+func quits(msgs []tea.Msg) bool {
+	return slices.ContainsFunc(msgs, func(msg tea.Msg) bool {
+		_, ok := msg.(tea.QuitMsg)
+		return ok
+	})
+}
+
+func TestWaitModel_firstOk(t *testing.T) {
+	m := NewWaitModel(nil, "bucket", "a", "b", "c").WithFirstOk(true).
+		WithPlain(io.Discard)
+	m.Init()
+
+	_, cmd := m.Update(waitMsg{item: m.items[0], err: errTest})
+	if quits(runCmd(cmd)) {
+		t.Fatal("quit after the first error")
+	}
+
+	_, cmd = m.Update(waitMsg{item: m.items[1], size: 42})
+	if !quits(runCmd(cmd)) {
+		t.Fatal("didn't quit after the first ok")
+	}
+	if err := context.Cause(m.running); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait canceled by %v, want %v", err, context.Canceled)
+	} else if !m.items[1].ok || m.items[1].size != 42 {
+		t.Errorf("item b = %+v, want ok with size 42", m.items[1])
+	}
+}
+
+func TestWaitModel_waitAll(t *testing.T) {
+	tests := []struct {
+		name     string
+		waitAll  bool
+		wantQuit []bool
+	}{
+		{name: "fail fast", wantQuit: []bool{true}},
+		{name: "wait all", waitAll: true, wantQuit: []bool{false, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewWaitModel(nil, "bucket", "a", "b", "c").
+				WithWaitAll(tt.waitAll).WithPlain(io.Discard)
+			m.Init()
+
+			msgs := []waitMsg{
+				{item: m.items[0], err: errTest},
+				{item: m.items[1], size: 42},
+				{item: m.items[2], size: 42},
+			}
+			for i, wantQuit := range tt.wantQuit {
+				_, cmd := m.Update(msgs[i])
+				if quits(runCmd(cmd)) != wantQuit {
+					t.Fatalf("quit after message %d: %v, want %v", i,
+						!wantQuit, wantQuit)
+				}
+			}
+
+			// Every wait fails, if any name failed.
+			if err := context.Cause(m.running); !errors.Is(err, errTest) {
+				t.Errorf("wait canceled by %v, want %v", err, errTest)
+			}
+		})
+	}
+}
+
+func TestWaitModel_maxActive(t *testing.T) {
+	m := NewWaitModel(nil, "bucket", "a", "b", "c", "d").WithWaitAll(true).
+		WithMaxActive(2).WithPlain(io.Discard)
+	m.Init()
+
+	activeNames := func() (names []string) {
+		for _, item := range m.items {
+			if item.active && !item.done {
+				names = append(names, item.name)
+			}
+		}
+		return
+	}
+
+	// Commands aren't run, because they would wait for started items.
+	steps := []struct {
+		msg  waitMsg
+		want []string
+	}{
+		{msg: waitMsg{item: m.items[0], started: true}, want: []string{"a", "b"}},
+		{msg: waitMsg{item: m.items[0], size: 42}, want: []string{"b", "c"}},
+		{msg: waitMsg{item: m.items[1], err: errTest}, want: []string{"c", "d"}},
+		{msg: waitMsg{item: m.items[2], size: 42}, want: []string{"d"}},
+	}
+
+	if got, want := activeNames(), []string{"a", "b"}; !slices.Equal(got, want) {
+		t.Fatalf("active %v after Init, want %v", got, want)
+	}
+	for i, step := range steps {
+		m.Update(step.msg)
+		if got := activeNames(); !slices.Equal(got, step.want) {
+			t.Errorf("active %v after message %d, want %v", got, i, step.want)
+		}
+	}
+}
+
+func TestWaitModel_sharedDeadline(t *testing.T) {
+	fake := newFakeS3(t)
+	m := NewWaitModel(fake.Client(), "bucket", "foo").WithTimeout(time.Hour)
+
+	// The waiter starts close to the shared deadline, set by Init. It must stop
+	// at that deadline, instead of waiting --max-wait since its own start.
+	m.deadline = time.Now().Add(100 * time.Millisecond)
+	started := time.Now()
+	err := m.waitObject(m.items[0].running, m.items[0], "foo"+okExt)
+	if err == nil {
+		t.Fatal("waitObject() = nil, want error")
+	} else if d := time.Since(started); d > 2*time.Second {
+		t.Errorf("waitObject() returned after %v", d)
+	}
+}
+
+func TestErrSnippet(t *testing.T) {
+	long := strings.Repeat("ы", errSnippetLen+10)
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "short", err: errors.New(" oops\n"), want: "oops"},
+		{
+			name: "long",
+			err:  errors.New(long),
+			want: long[:len("ы")*errSnippetLen] + "…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errSnippet(tt.err); got != tt.want {
+				t.Errorf("errSnippet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitModel_failedLine(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewWaitModel(nil, "bucket", "foo").WithPlain(&buf)
+	m.Init()
+
+	_, cmd := m.Update(waitMsg{item: m.items[0], err: errors.New("remote error")})
+	if !quits(runCmd(cmd)) {
+		t.Fatal("didn't quit after the error")
+	}
+	if !strings.Contains(buf.String(), "✗ failed:") ||
+		!strings.Contains(buf.String(), "remote error") {
+		t.Errorf("output %q, want failed line with the error", buf.String())
+	}
+}
+
+func TestCheckEmpty(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int64
+		allow   bool
+		wantErr bool
+	}{
+		{name: "not empty", size: 1},
+		{name: "empty", wantErr: true},
+		{name: "allowed empty", allow: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkEmpty("foo"+sqlExt, tt.size, tt.allow)
+			if tt.wantErr && err == nil {
+				t.Error("checkEmpty() = nil, want error")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("checkEmpty(): %v", err)
+			}
+		})
+	}
+}
+
+func TestWaitModel_absoluteDeadline(t *testing.T) {
+	tests := []struct {
+		name     string
+		deadline time.Duration
+		want     time.Duration
+	}{
+		{name: "no deadline", want: time.Hour},
+		{name: "earlier deadline", deadline: time.Minute, want: time.Minute},
+		{name: "later deadline", deadline: 2 * time.Hour, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deadline time.Time
+			if tt.deadline > 0 {
+				deadline = time.Now().Add(tt.deadline)
+			}
+			m := NewWaitModel(nil, "bucket", "foo").WithTimeout(time.Hour).
+				WithDeadline(deadline).WithPlain(io.Discard)
+			m.Init()
+
+			d := m.deadline.Sub(m.startedAt)
+			if d > tt.want || d < tt.want-time.Second {
+				t.Errorf("deadline in %v, want %v", d, tt.want)
+			}
+		})
+	}
+}
+
+func TestWait_passedDeadline(t *testing.T) {
+	oldUntil := waitUntil
+	waitUntil = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	t.Cleanup(func() { waitUntil = oldUntil })
+
+	err := Wait("foo")
+	if err == nil || !strings.Contains(err.Error(), "already passed") {
+		t.Errorf("Wait() = %v, want passed deadline error", err)
+	}
+}
+
+func TestWaitModel_suspend(t *testing.T) {
+	m := NewWaitModel(nil, "bucket", "foo")
+
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlZ})
+	if cmd == nil {
+		t.Fatal("C-z returned no command")
+	} else if _, ok := cmd().(tea.SuspendMsg); !ok {
+		t.Errorf("C-z returned %T, want tea.SuspendMsg", cmd())
+	}
+
+	// Width is asked again after resume.
+	if _, cmd := m.Update(tea.ResumeMsg{}); cmd == nil {
+		t.Error("resume returned no command")
+	}
+}
+
+func TestWaitModel_resize(t *testing.T) {
+	tests := []struct {
+		width int
+		want  int
+	}{
+		{width: 80, want: min(80-barPad*2, barMaxWidth)},
+		{width: 40, want: 40 - barPad*2},
+		{width: 200, want: barMaxWidth},
+		{width: 10, want: 1},
+	}
+
+	m := NewWaitModel(nil, "bucket", "foo")
+	for _, tt := range tests {
+		m.Update(tea.WindowSizeMsg{Width: tt.width})
+		if m.progress.Width != tt.want {
+			t.Errorf("width %d: progress width %d, want %d", tt.width,
+				m.progress.Width, tt.want)
+		}
+	}
+}
+
+func TestWaitModel_dataKey(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.Put("bucket", "foo"+okExt, nil)
+	fake.Put("bucket", "foo"+sqlExt, []byte("wrong"))
+	fake.Put("bucket", "dumps/foo.tar", []byte("data object"))
+
+	m := NewWaitModel(fake.Client(), "bucket", "foo").
+		WithDataKey("dumps/foo.tar").WithTimeout(time.Minute).
+		WithPlain(io.Discard)
+	m.Init()
+
+	msg, ok := m.waitOk(m.items[0])().(waitMsg)
+	if !ok {
+		t.Fatalf("waitOk() returned %T, want waitMsg", msg)
+	} else if msg.err != nil {
+		t.Fatalf("waitOk(): %v", msg.err)
+	} else if msg.size != int64(len("data object")) {
+		t.Errorf("size %d, want size of data object %d", msg.size,
+			len("data object"))
+	}
+}
+
+func TestBellMatches(t *testing.T) {
+	tests := []struct {
+		on     string
+		failed bool
+		want   bool
+	}{
+		{on: bellOk, want: true},
+		{on: bellOk, failed: true},
+		{on: bellError},
+		{on: bellError, failed: true, want: true},
+		{on: bellBoth, want: true},
+		{on: bellBoth, failed: true, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := bellMatches(tt.on, tt.failed); got != tt.want {
+			t.Errorf("bellMatches(%q, %v) = %v, want %v", tt.on, tt.failed, got,
+				tt.want)
+		}
+	}
+}
+
+func TestRingBell_notTerminal(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ringBell(f, bellBoth, false)
+	if fi, err := f.Stat(); err != nil {
+		t.Fatal(err)
+	} else if fi.Size() != 0 {
+		t.Errorf("bell written into regular file")
+	}
+}
+
+func TestWaitModel_WithTickInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		d    time.Duration
+		want time.Duration
+	}{
+		{name: "in range", d: 2 * time.Second, want: 2 * time.Second},
+		{name: "too often", d: time.Millisecond, want: minTickInterval},
+		{name: "too rare", d: time.Hour, want: maxTickInterval},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewWaitModel(nil, "bucket", "foo").WithTickInterval(tt.d)
+			if m.tick != tt.want {
+				t.Errorf("tick interval %v, want %v", m.tick, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitModel_tick(t *testing.T) {
+	m := NewWaitModel(nil, "bucket", "foo").WithTimeout(time.Minute).
+		WithTickInterval(minTickInterval).WithPlain(io.Discard)
+	m.Init()
+	m.startedAt = m.startedAt.Add(-30 * time.Second)
+	m.deadline = m.startedAt.Add(time.Minute)
+
+	_, cmd := m.Update(tickMsg(time.Now()))
+	if m.percent < 0.5 || m.percent > 0.6 {
+		t.Errorf("percent %v, want about 0.5", m.percent)
+	}
+
+	started := time.Now()
+	if _, ok := cmd().(tickMsg); !ok {
+		t.Fatal("tick isn't scheduled again")
+	} else if d := time.Since(started); d > time.Second {
+		t.Errorf("the next tick after %v, want %v", d, minTickInterval)
+	}
+}
+
+func TestWaitModel_WithNotify(t *testing.T) {
+	var events []WaitEvent
+	m := NewWaitModel(nil, "bucket", "a", "b").WithWaitAll(true).
+		WithPlain(io.Discard).
+		WithNotify(func(ev WaitEvent) { events = append(events, ev) })
+	m.Init()
+
+	msgs := []waitMsg{
+		{item: m.items[0], started: true},
+		{item: m.items[1], started: true},
+		{item: m.items[1], err: errTest},
+		{item: m.items[0], size: 42},
+	}
+	for _, msg := range msgs {
+		m.Update(msg)
+	}
+
+	want := []WaitEvent{
+		{Name: "a", Status: WaitStarted},
+		{Name: "b", Status: WaitStarted},
+		{Name: "b", Status: WaitError, Err: errTest},
+		{Name: "a", Status: WaitOk, Size: 42},
+	}
+	if !slices.Equal(events, want) {
+		t.Errorf("events %+v, want %+v", events, want)
+	}
+}
+
+func TestSplitBuckets(t *testing.T) {
+	tests := []struct {
+		name        string
+		objects     []string
+		prefix      string
+		wantNames   []string
+		wantBuckets []string
+		wantErr     bool
+	}{
+		{
+			name:        "pairs",
+			objects:     []string{"b1/foo", "b2/bar/baz"},
+			wantNames:   []string{"foo", "bar/baz"},
+			wantBuckets: []string{"b1", "b2"},
+		},
+		{
+			name:        "same name in multiple buckets",
+			objects:     []string{"b1/foo", "b2/foo"},
+			wantNames:   []string{"foo", "foo"},
+			wantBuckets: []string{"b1", "b2"},
+		},
+		{
+			name:        "with prefix",
+			objects:     []string{"b1/foo"},
+			prefix:      "dumps/",
+			wantNames:   []string{"dumps/foo"},
+			wantBuckets: []string{"b1"},
+		},
+		{name: "no bucket", objects: []string{"foo"}, wantErr: true},
+		{name: "empty bucket", objects: []string{"/foo"}, wantErr: true},
+		{name: "empty name", objects: []string{"b1/"}, wantErr: true},
+	}
+
+	oldPrefix := s3Prefix
+	t.Cleanup(func() { s3Prefix = oldPrefix })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Prefix = tt.prefix
+			names, buckets, err := splitBuckets(tt.objects)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("splitBuckets() = %q, %q, want error", names, buckets)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("splitBuckets(): %v", err)
+			}
+
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("names %q, want %q", names, tt.wantNames)
+			}
+			if !slices.Equal(buckets, tt.wantBuckets) {
+				t.Errorf("buckets %q, want %q", buckets, tt.wantBuckets)
+			}
+		})
+	}
+}
+
+func TestWaitModel_crossBucket(t *testing.T) {
+	fake := newFakeS3(t)
+	for bucket, body := range map[string]string{"b1": "123", "b2": "12345"} {
+		fake.Put(bucket, "foo"+okExt, nil)
+		fake.Put(bucket, "foo"+sqlExt, []byte(body))
+	}
+
+	client := fake.Client()
+	m := NewWaitModel(client, "bucket", "foo", "foo").
+		WithObjectBucket(0, client, "b1").WithObjectBucket(1, client, "b2").
+		WithTimeout(time.Minute).WithPlain(io.Discard)
+	m.Init()
+
+	for i, want := range []struct {
+		name string
+		size int64
+	}{{name: "b1/foo", size: 3}, {name: "b2/foo", size: 5}} {
+		item := m.items[i]
+		if name := m.itemName(item); name != want.name {
+			t.Errorf("item %d name %q, want %q", i, name, want.name)
+		}
+		msg := m.waitOk(item)().(waitMsg)
+		if msg.err != nil {
+			t.Errorf("waitOk(%s): %v", want.name, msg.err)
+		} else if msg.size != want.size {
+			t.Errorf("size of %s %d, want %d", want.name, msg.size, want.size)
+		}
+	}
+}
+
+func TestWaitModel_readError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "short", body: "oops", want: "oops"},
+		{name: "exact", body: "12345678", want: "12345678"},
+		{name: "truncated", body: "123456789", want: "12345678\n...(truncated)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+errorExt, []byte(tt.body))
+
+			m := NewWaitModel(fake.Client(), "bucket", "foo").
+				WithMaxErrorBytes(8)
+			err := m.readError(context.Background(), m.items[0], "foo"+errorExt)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("readError() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitModel_WithIntervalBackoff(t *testing.T) {
+	tests := []struct {
+		name string
+		d    time.Duration
+		want time.Duration
+	}{
+		{name: "default", want: listMaxDelay},
+		{name: "longer", d: 10 * time.Minute, want: 10 * time.Minute},
+		{name: "shorter than min delay", d: time.Second, want: listMinDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			m := NewWaitModel(fake.Client(), "bucket", "foo1", "foo2").
+				WithIntervalBackoff(tt.d).WithConcurrentMarkers(true).
+				WithPlain(io.Discard)
+			if m.pollMaxDelay != tt.want {
+				t.Errorf("max delay %v, want %v", m.pollMaxDelay, tt.want)
+			}
+
+			m.Init()
+			m.cancel(nil)
+			if m.lister == nil {
+				t.Fatal("lister isn't started")
+			} else if m.lister.maxDelay != tt.want {
+				t.Errorf("max delay of lister %v, want %v", m.lister.maxDelay,
+					tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitModel_showMeta(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.Put("bucket", "foo"+okExt, nil)
+	fake.store("bucket", "foo"+sqlExt, &fakeObject{
+		Body:     []byte("content"),
+		Metadata: map[string]string{"db": "prod", "tables": "3", "other": "x"},
+	})
+
+	m := NewWaitModel(fake.Client(), "bucket", "foo").
+		WithShowMeta([]string{"Tables", "X-Amz-Meta-Db", "missing"}).
+		WithTimeout(time.Minute).WithPlain(io.Discard)
+	m.Init()
+
+	msg := m.waitOk(m.items[0])().(waitMsg)
+	if msg.err != nil {
+		t.Fatalf("waitOk(): %v", msg.err)
+	} else if want := "tables=3 db=prod"; msg.meta != want {
+		t.Errorf("meta %q, want %q", msg.meta, want)
+	}
+}
+
+func TestDumbTerminal(t *testing.T) {
+	tests := []struct {
+		term string
+		want bool
+	}{
+		{term: "xterm-256color"},
+		{term: "dumb", want: true},
+		{term: "", want: runtime.GOOS != "windows"},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TERM", tt.term)
+		if got := dumbTerminal(); got != tt.want {
+			t.Errorf("dumbTerminal() with TERM=%q = %v, want %v", tt.term, got,
+				tt.want)
+		}
+	}
+}
+
+func TestWaitModel_plain(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewWaitModel(nil, "bucket", "a", "b").WithWaitAll(true).
+		WithPlain(&buf)
+	m.Init()
+
+	for _, msg := range []waitMsg{
+		{item: m.items[0], started: true},
+		{item: m.items[0], size: 42},
+	} {
+		_, cmd := m.Update(msg)
+		runCmd(cmd)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "✓ started") ||
+		!strings.Contains(lines[1], "✓ ok:") {
+		t.Errorf("plain output %q, want started and ok lines", buf.String())
+	}
+}
+
+func TestWaitModel_statusView(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []string
+		label   string
+		started []int
+		done    []int
+		want    string
+	}{
+		{
+			name:    "single pending",
+			objects: []string{"foo"},
+			want:    defaultPendingLabel,
+		},
+		{
+			name:    "single running",
+			objects: []string{"foo"},
+			started: []int{0},
+			want:    runningLabel,
+		},
+		{
+			name:    "custom label",
+			objects: []string{"foo"},
+			label:   "no producer",
+			want:    "no producer",
+		},
+		{
+			name:    "mixed",
+			objects: []string{"foo", "bar", "baz", "qux"},
+			started: []int{1, 2},
+			done:    []int{2, 3},
+			want:    "1 " + defaultPendingLabel + ", 1 " + runningLabel,
+		},
+		{
+			name:    "all done",
+			objects: []string{"foo", "bar"},
+			done:    []int{0, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewWaitModel(nil, "bucket", tt.objects...)
+			if tt.label != "" {
+				m.WithPendingLabel(tt.label)
+			}
+			for _, i := range tt.started {
+				m.items[i].startedAt = time.Now()
+			}
+			for _, i := range tt.done {
+				m.items[i].done = true
+			}
+			got := strings.TrimLeft(m.statusView(), " ")
+			if got != tt.want {
+				t.Errorf("statusView() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitModel_View_started(t *testing.T) {
+	m := NewWaitModel(nil, "bucket", "foo")
+	m.startedAt = time.Now()
+	m.deadline = m.startedAt.Add(time.Hour)
+
+	pending := m.View()
+	if !strings.Contains(pending, defaultPendingLabel) {
+		t.Errorf("no pending label in %q", pending)
+	}
+
+	m.items[0].startedAt = time.Now()
+	running := m.View()
+	if !strings.Contains(running, runningLabel) {
+		t.Errorf("no running label in %q", running)
+	} else if running == pending {
+		t.Error("view hasn't changed after .started")
+	}
+}
+
+func TestTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "500", err: responseError(http.StatusInternalServerError),
+			want: true},
+		{name: "503", err: responseError(http.StatusServiceUnavailable),
+			want: true},
+		{name: "429", err: responseError(http.StatusTooManyRequests),
+			want: true},
+		{name: "403", err: responseError(http.StatusForbidden)},
+		{name: "404", err: responseError(http.StatusNotFound)},
+		{name: "timeout", err: fmt.Errorf("head: %w", os.ErrDeadlineExceeded),
+			want: true},
+		{name: "other", err: errTest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transientError(tt.err); got != tt.want {
+				t.Errorf("transientError(%v) = %v, want %v", tt.err, got,
+					tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitModel_WithRetryTransient(t *testing.T) {
+	tests := []struct {
+		name    string
+		retry   bool
+		status  int
+		wantErr bool
+		wantN   int
+	}{
+		{
+			name:   "retried",
+			retry:  true,
+			status: http.StatusInternalServerError,
+			wantN:  2,
+		},
+		{
+			name:    "disabled",
+			status:  http.StatusInternalServerError,
+			wantErr: true,
+			wantN:   1,
+		},
+		{
+			name:    "forbidden",
+			retry:   true,
+			status:  http.StatusForbidden,
+			wantErr: true,
+			wantN:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			fake.Put("bucket", "foo"+sqlExt, []byte("content"))
+
+			var heads int
+			// The first HEAD of the data object fails.
+			fake.Handler = func(w http.ResponseWriter, r *http.Request) bool {
+				if r.Method != http.MethodHead ||
+					r.URL.Path != "/bucket/foo"+sqlExt {
+					return false
+				} else if heads++; heads > 1 {
+					return false
+				}
+				writeFakeError(w, tt.status, http.StatusText(tt.status))
+				return true
+			}
+
+			m := NewWaitModel(fake.Client(), "bucket", "foo").
+				WithRetryTransient(tt.retry)
+			m.deadline = time.Now().Add(time.Minute)
+			m.pollMaxDelay = time.Millisecond
+
+			item := m.items[0]
+			var h *s3.HeadObjectOutput
+			err := m.transientRetry(item.running,
+				func(ctx context.Context) (err error) {
+					h, err = m.headData(ctx, item, item.dataKey)
+					return
+				})
+			if tt.wantErr {
+				if err == nil {
+					t.Error("transientRetry() = nil, want error")
+				}
+			} else if err != nil {
+				t.Errorf("transientRetry(): %v", err)
+			} else if aws.ToInt64(h.ContentLength) != int64(len("content")) {
+				t.Errorf("size %d, want %d", aws.ToInt64(h.ContentLength),
+					len("content"))
+			}
+			if heads != tt.wantN {
+				t.Errorf("data object headed %d times, want %d", heads,
+					tt.wantN)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+
+	"github.com/dsh2dsh/expx-dbcopy/internal/retry"
+)
+
+// WithRetryTransient configures WaitModel to retry transient errors, like
+// timeouts and 5xx, of requests it makes after markers appeared, until its
+// deadline, like the object is still pending. Polling of markers itself
+// retries them anyway. Definitive errors, like 404 or 403, fail immediately.
+func (self *WaitModel) WithRetryTransient(v bool) *WaitModel {
+	self.retryTransient = v
+	return self
+}
+
+// transientRetry calls fn once, or, if WaitModel configured to retry
+// transient errors, until it succeeds or fails by non-transient error.
+func (self *WaitModel) transientRetry(ctx context.Context,
+	fn func(ctx context.Context) error,
+) error {
+	if !self.retryTransient {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, self.deadline)
+	defer cancel()
+
+	policy := retry.Policy{BaseDelay: listMinDelay, MaxDelay: self.pollMaxDelay}
+	return retry.Do(ctx, policy, func(ctx context.Context) error {
+		err := fn(ctx)
+		if err != nil && !transientError(err) {
+			return retry.Permanent(err)
+		}
+		return err
+	})
+}
+
+// transientError returns true, if err is a server side error, throttling or
+// network timeout, which can go away by itself.
+func transientError(err error) bool {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		code := respErr.HTTPStatusCode()
+		return code >= http.StatusInternalServerError ||
+			code == http.StatusTooManyRequests
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,111 @@
+// Package reorder implements writer, which writes concurrently produced
+// chunks in order of their sequence numbers.
+package reorder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// New returns Writer, which writes into w and buffers out of order chunks up
+// to maxBytes.
+func New(w io.Writer, maxBytes int64) *Writer {
+	return &Writer{
+		w:   w,
+		max: maxBytes,
+
+		pending: make(map[int][]byte),
+		changed: make(chan struct{}),
+	}
+}
+
+// Writer writes chunks into underlying writer in order of their sequence
+// numbers, starting from 0. A chunk, which isn't the next one, is buffered,
+// if it fits into max bytes, otherwise its Write blocks, until it fits. The
+// next chunk is never buffered, so it never blocks on a full buffer.
+type Writer struct {
+	w   io.Writer
+	max int64
+
+	mu      sync.Mutex
+	next    int
+	pending map[int][]byte
+	size    int64
+	changed chan struct{}
+	err     error
+}
+
+// Write writes chunk seq, or buffers it until all previous chunks are
+// written. It returns the first write error of underlying writer, or cause of
+// ctx, if it was done while Write waited for free space.
+func (self *Writer) Write(ctx context.Context, seq int, b []byte) error {
+	for {
+		self.mu.Lock()
+		if self.err != nil {
+			self.mu.Unlock()
+			return self.err
+		} else if seq < self.next {
+			self.mu.Unlock()
+			return fmt.Errorf("chunk %d already written", seq)
+		} else if seq == self.next {
+			err := self.flush(b)
+			self.mu.Unlock()
+			return err
+		} else if self.size+int64(len(b)) <= self.max {
+			self.pending[seq] = b
+			self.size += int64(len(b))
+			self.mu.Unlock()
+			return nil
+		}
+		changed := self.changed
+		self.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-changed:
+		}
+	}
+}
+
+// flush writes b and all buffered chunks after it, which are in order. It
+// must be called with locked mu.
+func (self *Writer) flush(b []byte) error {
+	defer self.notify()
+	for {
+		if _, err := self.w.Write(b); err != nil {
+			self.err = fmt.Errorf("write chunk %d: %w", self.next, err)
+			return self.err
+		}
+		self.next++
+
+		next, ok := self.pending[self.next]
+		if !ok {
+			return nil
+		}
+		delete(self.pending, self.next)
+		self.size -= int64(len(next))
+		b = next
+	}
+}
+
+func (self *Writer) notify() {
+	close(self.changed)
+	self.changed = make(chan struct{})
+}
+
+// Next returns sequence number of the next chunk it expects.
+func (self *Writer) Next() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.next
+}
+
+// Buffered returns number of bytes buffered now.
+func (self *Writer) Buffered() int64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.size
+}
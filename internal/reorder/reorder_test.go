@@ -0,0 +1,121 @@
+package reorder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errTest = errors.New("test error")
+
+func TestWriter_Write(t *testing.T) {
+	tests := []struct {
+		name  string
+		order []int
+	}{
+		{name: "in order", order: []int{0, 1, 2, 3}},
+		{name: "reversed", order: []int{3, 2, 1, 0}},
+		{name: "shuffled", order: []int{2, 0, 3, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := New(&buf, 1<<10)
+			ctx := context.Background()
+			for _, seq := range tt.order {
+				if err := w.Write(ctx, seq, []byte(strconv.Itoa(seq))); err != nil {
+					t.Fatalf("Write(%d): %v", seq, err)
+				}
+			}
+
+			if got := buf.String(); got != "0123" {
+				t.Errorf("written %q, want %q", got, "0123")
+			}
+			if n := w.Next(); n != len(tt.order) {
+				t.Errorf("Next() = %d, want %d", n, len(tt.order))
+			}
+			if n := w.Buffered(); n != 0 {
+				t.Errorf("Buffered() = %d, want 0", n)
+			}
+		})
+	}
+}
+
+func TestWriter_Write_again(t *testing.T) {
+	var buf bytes.Buffer
+	w := New(&buf, 1<<10)
+	if err := w.Write(context.Background(), 0, []byte("0")); err != nil {
+		t.Fatalf("Write(0): %v", err)
+	}
+	if err := w.Write(context.Background(), 0, []byte("0")); err == nil {
+		t.Error("Write(0) again, want error")
+	}
+}
+
+func TestWriter_Write_blocks(t *testing.T) {
+	var buf bytes.Buffer
+	w := New(&buf, 2)
+	ctx := context.Background()
+	if err := w.Write(ctx, 1, []byte("11")); err != nil {
+		t.Fatalf("Write(1): %v", err)
+	}
+
+	// Buffer is full, so chunk 2 waits for chunk 0.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var err2 error
+	go func() {
+		defer wg.Done()
+		err2 = w.Write(ctx, 2, []byte("22"))
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if got := buf.Len(); got != 0 {
+		t.Fatalf("written %d bytes before chunk 0", got)
+	}
+	if err := w.Write(ctx, 0, []byte("00")); err != nil {
+		t.Fatalf("Write(0): %v", err)
+	}
+	wg.Wait()
+
+	if err2 != nil {
+		t.Fatalf("Write(2): %v", err2)
+	} else if got := buf.String(); got != "001122" {
+		t.Errorf("written %q, want %q", got, "001122")
+	}
+}
+
+func TestWriter_Write_canceled(t *testing.T) {
+	var buf bytes.Buffer
+	w := New(&buf, 1)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errTest)
+
+	if err := w.Write(ctx, 1, []byte("11")); !errors.Is(err, errTest) {
+		t.Errorf("Write(1) = %v, want %v", err, errTest)
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) { return 0, errTest }
+
+func TestWriter_Write_error(t *testing.T) {
+	w := New(failWriter{}, 1<<10)
+	ctx := context.Background()
+	if err := w.Write(ctx, 1, []byte("1")); err != nil {
+		t.Fatalf("Write(1): %v", err)
+	}
+	if err := w.Write(ctx, 0, []byte("0")); !errors.Is(err, errTest) {
+		t.Errorf("Write(0) = %v, want %v", err, errTest)
+	}
+	// The first error is returned to every following Write.
+	if err := w.Write(ctx, 2, []byte("2")); !errors.Is(err, errTest) {
+		t.Errorf("Write(2) = %v, want %v", err, errTest)
+	}
+}
@@ -0,0 +1,110 @@
+// Package retry implements retries with exponential backoff and jitter.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy describes how many times and how often to retry.
+type Policy struct {
+	// Attempts is max number of attempts, including the first one. Zero means
+	// retry until context is done.
+	Attempts int
+
+	// BaseDelay is delay before the second attempt. It doubles for every next
+	// attempt, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Jitter is a fraction of delay, from 0 to 1, which randomly subtracted from
+	// it, so concurrent clients don't retry all together.
+	Jitter float64
+
+	// Budget, if not zero, is max total time of all delays. Do stops retrying,
+	// if the next delay exceeds it, so it doesn't include time of attempts
+	// themselves.
+	Budget time.Duration
+
+	// Notify, if not nil, is called before every delay with error of the failed
+	// attempt.
+	Notify func(err error, delay time.Duration)
+}
+
+// Delay returns delay before attempt n, counting from 1 for the first retry,
+// without jitter.
+func (self *Policy) Delay(n int) time.Duration {
+	d := self.BaseDelay
+	for i := 1; i < n && (self.MaxDelay == 0 || d < self.MaxDelay); i++ {
+		d *= 2
+	}
+
+	if self.MaxDelay > 0 {
+		return min(d, self.MaxDelay)
+	}
+	return d
+}
+
+func (self *Policy) jitter(d time.Duration) time.Duration {
+	if self.Jitter <= 0 || d <= 0 {
+		return d
+	}
+	return d - time.Duration(float64(d)*min(self.Jitter, 1)*rand.Float64())
+}
+
+// Do calls fn until it returns nil or permanent error, attempts or budget are
+// exhausted, or ctx is done. It returns the last error of fn.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error,
+) error {
+	var slept time.Duration
+	for n := 1; ; n++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		} else if p.Attempts > 0 && n >= p.Attempts {
+			return err
+		}
+
+		delay := p.jitter(p.Delay(n))
+		if p.Budget > 0 && slept+delay > p.Budget {
+			return err
+		}
+		slept += delay
+
+		if p.Notify != nil {
+			p.Notify(err, delay)
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("%w (last error: %w)", context.Cause(ctx), err)
+		case <-t.C:
+		}
+	}
+}
+
+// Permanent wraps err, so Do stops retrying and returns err.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (self *permanentError) Error() string { return self.err.Error() }
+
+func (self *permanentError) Unwrap() error { return self.err }
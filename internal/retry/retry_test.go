@@ -0,0 +1,193 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTest = errors.New("test error")
+
+func TestPolicy_Delay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		n      int
+		want   time.Duration
+	}{
+		{
+			name:   "first retry",
+			policy: Policy{BaseDelay: time.Second},
+			n:      1,
+			want:   time.Second,
+		},
+		{
+			name:   "doubles",
+			policy: Policy{BaseDelay: time.Second},
+			n:      4,
+			want:   8 * time.Second,
+		},
+		{
+			name:   "capped",
+			policy: Policy{BaseDelay: time.Second, MaxDelay: 5 * time.Second},
+			n:      4,
+			want:   5 * time.Second,
+		},
+		{
+			name:   "capped far away",
+			policy: Policy{BaseDelay: time.Second, MaxDelay: time.Minute},
+			n:      1000,
+			want:   time.Minute,
+		},
+		{
+			name:   "base above max",
+			policy: Policy{BaseDelay: time.Minute, MaxDelay: time.Second},
+			n:      1,
+			want:   time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Delay(tt.n); got != tt.want {
+				t.Errorf("Delay(%d) = %v, want %v", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_jitter(t *testing.T) {
+	p := Policy{Jitter: 0.5}
+	for range 100 {
+		d := p.jitter(time.Second)
+		if d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("jitter(1s) = %v, want between 500ms and 1s", d)
+		}
+	}
+
+	p.Jitter = 0
+	if d := p.jitter(time.Second); d != time.Second {
+		t.Errorf("jitter(1s) without Jitter = %v, want 1s", d)
+	}
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    Policy
+		failures  int
+		permanent bool
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "success",
+			policy:    Policy{Attempts: 3},
+			wantCalls: 1,
+		},
+		{
+			name:      "success after retries",
+			policy:    Policy{Attempts: 3},
+			failures:  2,
+			wantCalls: 3,
+		},
+		{
+			name:      "attempts exhausted",
+			policy:    Policy{Attempts: 3},
+			failures:  5,
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			name:      "unlimited attempts",
+			failures:  5,
+			wantCalls: 6,
+		},
+		{
+			name:      "permanent",
+			policy:    Policy{Attempts: 3},
+			failures:  5,
+			permanent: true,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name: "budget exhausted",
+			policy: Policy{
+				BaseDelay: time.Millisecond,
+				Budget:    3 * time.Millisecond,
+			},
+			failures: 5,
+			// Delays 1ms and 2ms fit into the budget, 4ms doesn't.
+			wantCalls: 3,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls, notified int
+			tt.policy.Notify = func(err error, delay time.Duration) {
+				notified++
+			}
+			err := Do(context.Background(), tt.policy,
+				func(ctx context.Context) error {
+					calls++
+					if calls <= tt.failures {
+						if tt.permanent {
+							return Permanent(errTest)
+						}
+						return errTest
+					}
+					return nil
+				})
+
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, errTest) {
+					t.Errorf("Do() = %v, want %v", err, errTest)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Do() = %v, want nil", err)
+			}
+			if notified != calls-1 {
+				t.Errorf("notified = %d, want %d", notified, calls-1)
+			}
+		})
+	}
+}
+
+func TestDo_canceled(t *testing.T) {
+	errCause := errors.New("test cause")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	policy := Policy{BaseDelay: time.Hour}
+
+	var calls int
+	err := Do(ctx, policy, func(ctx context.Context) error {
+		calls++
+		cancel(errCause)
+		return errTest
+	})
+
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+	if !errors.Is(err, errCause) {
+		t.Errorf("Do() = %v, want cause %v", err, errCause)
+	}
+	if !errors.Is(err, errTest) {
+		t.Errorf("Do() = %v, want last error %v", err, errTest)
+	}
+}
+
+func TestPermanent_nil(t *testing.T) {
+	if err := Permanent(nil); err != nil {
+		t.Errorf("Permanent(nil) = %v, want nil", err)
+	}
+}